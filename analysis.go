@@ -3,95 +3,18 @@ package loadtest
 import (
 	"fmt"
 	"math"
-
-	"gonum.org/v1/gonum/mat"
+	"strings"
+	"time"
 )
 
-func quadraticRegression(results []*TestResult, latencyPercentile LatencyPercentile) (float64, float64, float64, error) {
-	// Extract concurrency and latency data
-	n := len(results)
-	if n < 3 {
-		return 0, 0, 0, fmt.Errorf("insufficient data points for quadratic regression (need at least 3)")
-	}
-
-	concurrency := make([]float64, n)
-	latency := make([]float64, n)
-	for i, res := range results {
-		if res.Errors > 0 {
-			fmt.Printf("Warning: %d out of %d requests returned errors. Results may not be accurate\n", res.Errors, res.Completed)
-		}
-		concurrency[i] = float64(res.Connections)
-		latency[i] = res.Latency(latencyPercentile)
-	}
-
-	// Create the design matrix for quadratic regression
-	X := mat.NewDense(n, 3, nil) // Each row: [1, x, x^2]
-	y := mat.NewVecDense(n, latency)
-	for i := 0; i < n; i++ {
-		X.Set(i, 0, 1)                             // Intercept term
-		X.Set(i, 1, concurrency[i])                // Linear term
-		X.Set(i, 2, concurrency[i]*concurrency[i]) // Quadratic term
-	}
-
-	// Compute (XᵀX)
-	var XT mat.Dense
-	XT.Mul(X.T(), X) // XT = XᵀX
-
-	// Invert (XᵀX)
-	var XTInv mat.Dense
-	err := XTInv.Inverse(&XT)
-	if err != nil {
-		return 0, 0, 0, fmt.Errorf("failed to invert matrix: %w", err)
-	}
-
-	// Compute (Xᵀy)
-	var XTy mat.VecDense
-	XTy.MulVec(X.T(), y)
-
-	// Compute beta = (XᵀX)^(-1)(Xᵀy)
-	var beta mat.VecDense
-	beta.MulVec(&XTInv, &XTy)
-
-	// Extract coefficients: beta = [c, b, a]
-	c := beta.AtVec(0) // Intercept
-	b := beta.AtVec(1) // Linear coefficient
-	a := beta.AtVec(2) // Quadratic coefficient
-
-	return a, b, c, nil
-}
-
-func predictConcurrencyQuad(a, b, c float64, targetLatency int) (float64, error) {
-	// Solve ax^2 + bx + c = targetLatency for x
-	// x = (-b ± sqrt(b^2 - 4ac)) / 2a
-	delta := b*b - 4*a*(c-float64(targetLatency))
-	if delta < 0 {
-		return 0, fmt.Errorf("no real solutions for concurrency at target latency %dms", targetLatency)
-	}
-
-	// Return the positive root (the other root is typically negative and irrelevant)
-	return (-b + math.Sqrt(delta)) / (2 * a), nil
-}
-
-func validatePrediction(a, b, c float64, targetLatency int, latencyPercentile LatencyPercentile, results []*TestResult) error {
-	// Calculate the discriminant
-	discriminant := b*b - 4*a*(c-float64(targetLatency))
-
-	if discriminant < 0 {
-		// No real roots
-		return fmt.Errorf("target latency %dms cannot be achieved based on the quadratic fit", targetLatency)
-	}
-
-	// Calculate the roots
-	root1 := (-b + math.Sqrt(discriminant)) / (2 * a)
-	root2 := (-b - math.Sqrt(discriminant)) / (2 * a)
-
+func validatePrediction(predicted float64, targetLatency int, latencyPercentile LatencyPercentile, results []*TestResult) error {
 	// Find the observed range
-	minConnections := float64(results[0].Connections)
-	maxConnections := float64(results[len(results)-1].Connections)
+	minLoad := results[0].Load()
+	maxLoad := results[len(results)-1].Load()
 
-	// Check if the roots are within the observed range
-	if (root1 < minConnections || root1 > maxConnections) && (root2 < minConnections || root2 > maxConnections) {
-		return fmt.Errorf("predicted roots (%.2f, %.2f) are outside the observed concurrency range [%.0f, %.0f]. Target latency may not be valid", root1, root2, minConnections, maxConnections)
+	// Check if the prediction is within the observed range
+	if predicted < minLoad || predicted > maxLoad {
+		return fmt.Errorf("predicted %s %.2f is outside the observed range [%.0f, %.0f]. Target latency may not be valid", strings.ToLower(results[0].LoadName()), predicted, minLoad, maxLoad)
 	}
 
 	// Check if all observed latencies are above the target
@@ -110,63 +33,263 @@ func validatePrediction(a, b, c float64, targetLatency int, latencyPercentile La
 	return nil
 }
 
+// interpolateThroughput interpolates the throughput at predictedConnections
+// between the mean throughput of the adjacent steps.
 func interpolateThroughput(results []*TestResult, predictedConnections float64) (float64, error) {
+	// Average repeated trials of the same step
+	loads := []float64{}
+	throughputs := []float64{}
+	trials := []int{}
+	for _, res := range results {
+		if n := len(loads); n > 0 && loads[n-1] == res.Load() {
+			throughputs[n-1] += res.Throughput
+			trials[n-1]++
+			continue
+		}
+		loads = append(loads, res.Load())
+		throughputs = append(throughputs, res.Throughput)
+		trials = append(trials, 1)
+	}
+	for i := range throughputs {
+		throughputs[i] /= float64(trials[i])
+	}
+
 	// Ensure we have enough results for interpolation
-	if len(results) < 2 {
+	if len(loads) < 2 {
 		return 0, fmt.Errorf("not enough test results to interpolate")
 	}
 
-	// Find the test results adjacent to predictedConnections
-	var predictedLow, predictedHigh *TestResult
-	for _, res := range results {
-		if float64(res.Connections) >= predictedConnections {
-			predictedHigh = res
+	// Find the steps adjacent to predictedConnections
+	low, high := -1, -1
+	for i, load := range loads {
+		if load >= predictedConnections {
+			high = i
 			break
 		}
-		predictedLow = res
+		low = i
 	}
 
-	// Check if adjacent results were found
-	if predictedLow == nil || predictedHigh == nil {
-		return 0, fmt.Errorf("predicted connections %.2f is out of bounds for the test results", predictedConnections)
+	// Check if adjacent steps were found
+	if high >= 0 && loads[high] == predictedConnections {
+		return throughputs[high], nil
+	}
+	if low < 0 || high < 0 {
+		return 0, fmt.Errorf("predicted load %.2f is out of bounds for the test results", predictedConnections)
 	}
 
 	// Perform linear interpolation
-	x1, y1 := float64(predictedLow.Connections), predictedLow.Throughput
-	x2, y2 := float64(predictedHigh.Connections), predictedHigh.Throughput
+	x1, y1 := loads[low], throughputs[low]
+	x2, y2 := loads[high], throughputs[high]
 	predictedThroughput := y1 + (y2-y1)*(predictedConnections-x1)/(x2-x1)
 
 	return predictedThroughput, nil
 }
 
-func analyzeAndPredict(targetLatency int, latencyPercentile LatencyPercentile, results []*TestResult) (float64, error) {
-	// Perform quadratic regression
-	a, b, c, err := quadraticRegression(results, latencyPercentile)
+// endpointResults replaces each aggregate result with the result for a single
+// endpoint, so the analysis can target it. An empty endpoint keeps the
+// aggregates.
+func endpointResults(results []*TestResult, endpoint string) ([]*TestResult, error) {
+	if endpoint == "" {
+		return results, nil
+	}
+	selected := make([]*TestResult, len(results))
+	for i, res := range results {
+		selected[i] = res.Endpoint(endpoint)
+		if selected[i] == nil {
+			return nil, fmt.Errorf("no results for endpoint %q at %s %g", endpoint, strings.ToLower(res.LoadName()), res.Load())
+		}
+	}
+	return selected, nil
+}
+
+// illConditioned is the condition number above which a fit is reported as
+// unreliable
+const illConditioned = 1e8
+
+// Analyze predicts the highest load that meets both TargetLatency and
+// MaxErrorRate from the results of a run, in the order they ran. Steps whose
+// error rate exceeds MaxErrorRate are left out of the latency fit, and the
+// load at which the error rate crosses the limit caps the prediction. The
+// report is returned even when no prediction could be made, with the reason
+// in its Error field.
+func (r *Runner) Analyze(results []*TestResult) (*Report, error) {
+	started := time.Now()
+	report := &Report{
+		TargetLatency:     r.TargetLatency,
+		LatencyPercentile: r.LatencyPercentile,
+		MaxErrorRate:      r.MaxErrorRate,
+		Endpoint:          r.Endpoint,
+		Results:           results,
+		Steps:             []*StepStats{},
+		Fits:              []*ModelFit{},
+		Warnings:          []string{},
+	}
+	defer func() { report.AnalysisDuration = time.Since(started) }()
+
+	err := r.analyze(report)
+	if err != nil {
+		report.Error = err.Error()
+	}
+	return report, err
+}
+
+func (r *Runner) analyze(report *Report) error {
+	if len(report.Results) == 0 {
+		return fmt.Errorf("no test results to analyze")
+	}
+	for _, res := range report.Results {
+		if warning := res.littlesLawWarning(r.LittlesLawTolerance); warning != "" {
+			report.warnf("%s %g: %s", strings.ToLower(res.LoadName()), res.Load(), warning)
+		}
+	}
+
+	results, err := endpointResults(report.Results, r.Endpoint)
 	if err != nil {
-		return 0, fmt.Errorf("failed to perform quadratic regression: %w", err)
+		return err
+	}
+	loadName := strings.ToLower(results[0].LoadName())
+	report.Steps = stepStatistics(results, r.LatencyPercentile, r.MaxCV)
+	for _, step := range report.Steps {
+		if step.Unstable {
+			report.warnf("%s %g is unstable, latency varies by %.1f%% across trials (max %.1f%%)", loadName, step.Load, step.LatencyCV*100, r.MaxCV*100)
+		}
 	}
 
-	// Predict concurrency for 100ms latency using quadratic regression
-	predictedConcurrencyQuad, err := predictConcurrencyQuad(a, b, c, targetLatency)
+	// Exclude steps that exceed the error rate limit from the latency fit
+	passing := []*TestResult{}
+	excluded := []float64{}
+	for _, step := range report.Steps {
+		if step.MeanErrorRate > r.MaxErrorRate {
+			excluded = append(excluded, step.Load)
+			continue
+		}
+		if step.MeanErrorRate > 0 {
+			report.warnf("%.2f%% of requests failed at %s %g. Results may not be accurate", step.MeanErrorRate*100, loadName, step.Load)
+		}
+		passing = append(passing, step.Trials...)
+	}
+	errorLimit, limited, err := errorRateLimit(report.Steps, r.MaxErrorRate)
+	if err != nil {
+		return err
+	}
+
+	prediction, err := r.predictLatency(report, passing)
 	if err != nil {
-		return 0, fmt.Errorf("failed to predict concurrency: %w", err)
+		if !limited {
+			return err
+		}
+		// The error rate limit still bounds the load
+		report.warnf("could not predict %s from latency: %v", loadName, err)
+		prediction = &Prediction{Model: r.Model, Confidence: r.Confidence, Coefficients: []CoefficientInterval{}}
+	}
+	report.Prediction = prediction
+	prediction.Excluded = excluded
+	prediction.Constraint = "latency"
+	r.analyzeSaturation(prediction, report.Steps, report.Model)
+	if !limited {
+		return nil
+	}
+
+	prediction.ErrorRateLoad = errorLimit
+	if report.Model != nil && prediction.Load <= errorLimit {
+		return nil
+	}
+
+	// The error rate is the binding constraint
+	prediction.Constraint = "error rate"
+	prediction.Load = errorLimit
+	prediction.LoadLow = math.Min(prediction.LoadLow, errorLimit)
+	prediction.LoadHigh = errorLimit
+	if report.Model == nil {
+		prediction.LoadLow = errorLimit
+	}
+	if prediction.RPS, err = interpolateThroughput(results, prediction.Load); err != nil {
+		return fmt.Errorf("failed to interpolate throughput: %w", err)
+	}
+	prediction.RPSHigh = prediction.RPS
+	if prediction.RPSLow, err = interpolateThroughput(results, prediction.LoadLow); err != nil {
+		prediction.RPSLow = prediction.RPS
 	}
+	return nil
+}
 
-	// Validate the prediction
-	if err := validatePrediction(a, b, c, targetLatency, latencyPercentile, results); err != nil {
-		return 0, err
+// errorRateLimit returns the load at which the mean error rate of the steps
+// first exceeds maxErrorRate, interpolated between the adjacent steps. It
+// returns false if no step exceeds the limit, and fails if the first one does.
+func errorRateLimit(steps []*StepStats, maxErrorRate float64) (float64, bool, error) {
+	for i, step := range steps {
+		if step.MeanErrorRate <= maxErrorRate {
+			continue
+		}
+		if i == 0 {
+			return 0, false, fmt.Errorf("error rate %.2f%% at the lowest load %g already exceeds %.2f%%", step.MeanErrorRate*100, step.Load, maxErrorRate*100)
+		}
+		previous := steps[i-1]
+		fraction := (maxErrorRate - previous.MeanErrorRate) / (step.MeanErrorRate - previous.MeanErrorRate)
+		return previous.Load + fraction*(step.Load-previous.Load), true, nil
 	}
+	return 0, false, nil
+}
 
-	predictedRPS, err := interpolateThroughput(results, predictedConcurrencyQuad)
+// predictLatency fits the runner's model to the results and predicts the load
+// at TargetLatency, recording the fits in the report. Every model is compared
+// by goodness of fit; with ModelAuto the best of them is used. Confidence
+// intervals are estimated from BootstrapSamples refits.
+func (r *Runner) predictLatency(report *Report, results []*TestResult) (*Prediction, error) {
+	targetLatency, latencyPercentile, modelType := r.TargetLatency, r.LatencyPercentile, r.Model
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no results within the error rate limit to fit")
+	}
+	loadName := results[0].LoadName()
+
+	// Compare all models
+	fits, err := compareModels(targetLatency, latencyPercentile, results, r.WeightBandwidth)
 	if err != nil {
-		return 0, fmt.Errorf("failed to interpolate throughput: %w", err)
+		return nil, err
 	}
+	report.Fits = fits
 
-	// Print analysis results
-	fmt.Printf("\nAnalysis Results:\n")
-	fmt.Printf("Quadratic regression equation: Latency (ms) = %.2fx^2 + %.2fx + %.2f\n", a, b, c)
-	fmt.Printf("Predicted Concurrency for %dms Latency: %.2f\n", targetLatency, predictedConcurrencyQuad)
-	fmt.Printf("Predicted RPS for %dms (Concurrency %.2f): %.2f\n", targetLatency, predictedConcurrencyQuad, predictedRPS)
+	var model Model
+	var predictedLoad float64
+	if modelType == ModelAuto {
+		best, reason, err := selectModel(fits)
+		if err != nil {
+			return nil, err
+		}
+		report.Selection = reason
+		model, predictedLoad = best.Model, best.Prediction
+	} else {
+		// Fit the model
+		model, err = fitModel(modelType, results, latencyPercentile, targetLatency, r.WeightBandwidth)
+		if err != nil {
+			return nil, err
+		}
+
+		// Predict the load for the target latency
+		predictedLoad, err = model.Solve(float64(targetLatency))
+		if err != nil {
+			return nil, fmt.Errorf("failed to predict %s: %w", strings.ToLower(loadName), err)
+		}
+
+		// Validate the prediction
+		if err := validatePrediction(predictedLoad, targetLatency, latencyPercentile, results); err != nil {
+			return nil, err
+		}
+	}
+	report.Model = model
+	if conditioned, ok := model.(ConditionedModel); ok && conditioned.ConditionNumber() > illConditioned {
+		report.warnf("the %s fit is ill-conditioned (condition number %.3g), its coefficients are sensitive to noise", model.Name(), conditioned.ConditionNumber())
+	}
 
-	return predictedConcurrencyQuad, nil
+	// Estimate confidence intervals, falling back to the point estimate
+	prediction, err := bootstrapPrediction(model, targetLatency, latencyPercentile, r.WeightBandwidth, results, predictedLoad, r.BootstrapSamples, r.Confidence)
+	if err != nil {
+		report.warnf("could not estimate confidence intervals: %v", err)
+		prediction, err = bootstrapPrediction(model, targetLatency, latencyPercentile, r.WeightBandwidth, results, predictedLoad, 0, r.Confidence)
+		if err != nil {
+			return nil, err
+		}
+	}
+	prediction.LatencyLoad = prediction.Load
+	return prediction, nil
 }
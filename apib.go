@@ -0,0 +1,145 @@
+package loadtest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIBGenerator generates load by shelling out to the apib binary, which must
+// be on PATH.
+type APIBGenerator struct {
+	Request *Request
+	// Progress is where warnings about apib's stderr output are printed, they
+	// are discarded if it is nil.
+	Progress io.Writer
+}
+
+func NewAPIBGenerator(request *Request) *APIBGenerator {
+	return &APIBGenerator{Request: request}
+}
+
+func (g *APIBGenerator) Run(concurrency, duration int) (*TestResult, error) {
+	args, cleanup, err := g.requestArgs()
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	args = append([]string{"-S", "-c", fmt.Sprint(concurrency), "-d", fmt.Sprint(duration)}, args...)
+	cmd := exec.Command("apib", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to execute apib: %w\nStdout: %s\nStderr: %s", err, stdout.String(), stderr.String())
+	}
+
+	if stderr.Len() > 0 && g.Progress != nil {
+		fmt.Fprintf(g.Progress, "Warning: apib produced stderr output:\n%s\n", stderr.String())
+	}
+
+	output := stdout.String()
+	return parseCSVOutput(output)
+}
+
+func (g *APIBGenerator) Warmup() error {
+	args, cleanup, err := g.requestArgs()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	cmd := exec.Command("apib", append([]string{"-S", "-1"}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to execute apib: %w\nStdout: %s\nStderr: %s", err, stdout.String(), stderr.String())
+	}
+
+	if stderr.Len() > 0 {
+		return fmt.Errorf("apib produced stderr output: %s", stderr.String())
+	}
+
+	return nil
+}
+
+// DrainConnections waits for the TIME_WAIT connections left by previous runs
+// to clear, so they do not exhaust the ports apib opens new connections on.
+func (g *APIBGenerator) DrainConnections(w io.Writer) error {
+	return waitForConnectionsToClear(w, 100)
+}
+
+func waitForConnectionsToClear(w io.Writer, threshold int) error {
+	for {
+		cmd := exec.Command("sh", "-c", "netstat -an | grep TIME_WAIT | wc -l")
+		out, err := cmd.Output()
+		if err != nil {
+			return fmt.Errorf("failed to execute netstat: %w", err)
+		}
+
+		// Parse the number of TIME_WAIT connections
+		count, err := strconv.Atoi(strings.TrimSpace(string(out)))
+		if err != nil {
+			return fmt.Errorf("failed to parse TIME_WAIT count: %w", err)
+		}
+
+		if count <= threshold {
+			break
+		}
+
+		fmt.Fprintf(w, "Waiting for connections to clear: %d TIME_WAIT\n", count)
+		time.Sleep(5 * time.Second) // Adjust as needed
+	}
+	return nil
+}
+
+// requestArgs translates the request into apib arguments, ending with the URL.
+// apib reads request bodies from a file, so the body is written to a
+// temporary file that cleanup removes.
+func (g *APIBGenerator) requestArgs() ([]string, func(), error) {
+	cleanup := func() {}
+	args := []string{}
+	req := g.Request
+
+	if req.Method != "" && req.Method != http.MethodGet {
+		args = append(args, "-x", req.Method)
+	}
+	for name, values := range req.Header {
+		for _, value := range values {
+			if http.CanonicalHeaderKey(name) == "Content-Type" {
+				args = append(args, "-t", value)
+				continue
+			}
+			args = append(args, "-H", fmt.Sprintf("%s: %s", name, value))
+		}
+	}
+
+	if len(req.Body) > 0 {
+		f, err := os.CreateTemp("", "loadtest-body-*")
+		if err != nil {
+			return nil, cleanup, fmt.Errorf("failed to create request body file: %w", err)
+		}
+		cleanup = func() { os.Remove(f.Name()) }
+		if _, err := f.Write(req.Body); err != nil {
+			f.Close()
+			cleanup()
+			return nil, func() {}, fmt.Errorf("failed to write request body file: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			cleanup()
+			return nil, func() {}, fmt.Errorf("failed to write request body file: %w", err)
+		}
+		args = append(args, "-f", f.Name())
+	}
+
+	return append(args, req.URL), cleanup, nil
+}
@@ -0,0 +1,265 @@
+package loadtest
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Assertion is a service level objective checked against a report, such as
+// "p99 < 200ms at concurrency 50", "error rate < 0.1%" or
+// "predicted concurrency >= 120". Latency, error rate and throughput
+// assertions hold at the given step, or at the predicted load without one.
+type Assertion struct {
+	// Expression is the assertion as written
+	Expression string
+
+	metric     string
+	percentile LatencyPercentile
+	op         string
+	threshold  float64
+	// loadName and load select the step, loadName is "" for the predicted
+	// load
+	loadName string
+	load     float64
+}
+
+// AssertionResult is the outcome of checking an assertion
+type AssertionResult struct {
+	Assertion string `json:"assertion"`
+	Passed    bool   `json:"passed"`
+	// Actual is the value the assertion was checked against, and Detail
+	// describes it and where it was measured.
+	Actual float64 `json:"actual"`
+	Detail string  `json:"detail"`
+}
+
+const (
+	metricLatency       = "latency"
+	metricErrorRate     = "error rate"
+	metricThroughput    = "throughput"
+	metricPredictedLoad = "predicted load"
+	metricPredictedRPS  = "predicted rps"
+)
+
+// assertionPattern matches metric, op, value, unit and optionally the step
+var assertionPattern = regexp.MustCompile(`^(.+?)\s*(<=|>=|<|>)\s*([0-9.]+(?:e[+-]?[0-9]+)?)\s*(ms|s|%|rps)?(?:\s+at\s+(concurrency|rate)\s+([0-9.]+(?:e[+-]?[0-9]+)?))?$`)
+
+// ParseAssertion parses an assertion of the form
+// "<metric> <op> <value>[unit] [at concurrency|rate <load>]". Metrics are a
+// latency percentile such as p99 or p99.9, avg, "error rate", rps (or
+// throughput), "predicted concurrency", "predicted rate" and "predicted rps".
+// Ops are <, <=, > and >=. Latencies are in ms unless given in s, and error
+// rates are fractions unless given in %.
+func ParseAssertion(s string) (*Assertion, error) {
+	expression := strings.Join(strings.Fields(s), " ")
+	match := assertionPattern.FindStringSubmatch(strings.ToLower(expression))
+	if match == nil {
+		return nil, fmt.Errorf("invalid assertion %q: expected <metric> <op> <value> [at concurrency|rate <load>]", s)
+	}
+	a := &Assertion{Expression: expression, op: match[2], loadName: match[5]}
+	value, err := strconv.ParseFloat(match[3], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid assertion %q: %w", s, err)
+	}
+	unit := match[4]
+	if a.loadName != "" {
+		if a.load, err = strconv.ParseFloat(match[6], 64); err != nil {
+			return nil, fmt.Errorf("invalid assertion %q: %w", s, err)
+		}
+	}
+
+	units := []string{""}
+	switch metric := match[1]; metric {
+	case "error rate":
+		a.metric, units = metricErrorRate, []string{"", "%"}
+		if unit == "%" {
+			value /= 100
+		}
+	case "rps", "throughput":
+		a.metric, units = metricThroughput, []string{"", "rps"}
+	case "predicted concurrency", "predicted rate", "predicted load":
+		a.metric = metricPredictedLoad
+		if metric == "predicted rate" {
+			units = []string{"", "rps"}
+		}
+	case "predicted rps", "predicted throughput":
+		a.metric, units = metricPredictedRPS, []string{"", "rps"}
+	default:
+		a.metric, units = metricLatency, []string{"", "ms", "s"}
+		if a.percentile, err = ParseLatencyPercentile(metric, true); err != nil {
+			return nil, fmt.Errorf("invalid assertion %q: unknown metric %q", s, metric)
+		}
+		if unit == "s" {
+			value *= 1000
+		}
+	}
+	if !slices.Contains(units, unit) {
+		return nil, fmt.Errorf("invalid assertion %q: unit %q does not apply to %s", s, unit, match[1])
+	}
+	if a.loadName != "" && (a.metric == metricPredictedLoad || a.metric == metricPredictedRPS) {
+		return nil, fmt.Errorf("invalid assertion %q: predictions do not apply at a step", s)
+	}
+	a.threshold = value
+	return a, nil
+}
+
+// holds reports whether value satisfies the assertion's comparison
+func (a *Assertion) holds(value float64) bool {
+	switch a.op {
+	case "<":
+		return value < a.threshold
+	case "<=":
+		return value <= a.threshold
+	case ">":
+		return value > a.threshold
+	}
+	return value >= a.threshold
+}
+
+// value reads the assertion's metric from a step's trials, averaged
+func (a *Assertion) value(trials []*TestResult) float64 {
+	return meanOf(trials, func(res *TestResult) float64 {
+		switch a.metric {
+		case metricErrorRate:
+			return res.ErrorRate()
+		case metricThroughput:
+			return res.Throughput
+		}
+		return res.Latency(a.percentile)
+	})
+}
+
+func (a *Assertion) format(value float64) string {
+	switch a.metric {
+	case metricLatency:
+		return fmt.Sprintf("%s %.2fms", a.percentile, value)
+	case metricErrorRate:
+		return fmt.Sprintf("error rate %.3g%%", value*100)
+	case metricThroughput, metricPredictedRPS:
+		return fmt.Sprintf("%.2f RPS", value)
+	}
+	return fmt.Sprintf("%.2f", value)
+}
+
+// Assert checks every assertion against the report, records the results in
+// report.Assertions and reports whether all of them passed.
+func (r *Report) Assert(assertions []*Assertion) bool {
+	passed := true
+	for _, assertion := range assertions {
+		result := r.assert(assertion)
+		r.Assertions = append(r.Assertions, result)
+		passed = passed && result.Passed
+	}
+	return passed
+}
+
+func (r *Report) assert(a *Assertion) *AssertionResult {
+	result := &AssertionResult{Assertion: a.Expression}
+	lowerName := strings.ToLower(r.LoadName())
+
+	switch a.metric {
+	case metricPredictedLoad, metricPredictedRPS:
+		if r.Prediction == nil {
+			result.Detail = "no prediction was made"
+			return result
+		}
+		result.Actual = r.Prediction.Load
+		if a.metric == metricPredictedRPS {
+			result.Actual = r.Prediction.RPS
+		}
+		result.Passed = a.holds(result.Actual)
+		result.Detail = "predicted " + a.format(result.Actual)
+		if a.metric == metricPredictedLoad {
+			result.Detail = fmt.Sprintf("predicted %s %.2f", lowerName, result.Actual)
+		}
+		return result
+	}
+
+	var trials []*TestResult
+	var where string
+	if a.loadName != "" {
+		if a.loadName != lowerName {
+			result.Detail = fmt.Sprintf("the results are %s results", lowerName)
+			return result
+		}
+		results := r.Results
+		if r.Check != nil {
+			results = append(results[:len(results):len(results)], r.Check)
+		}
+		trials, where = groupByLoad(results)[a.load], fmt.Sprintf("%s %g", lowerName, a.load)
+		if len(trials) == 0 {
+			result.Detail = fmt.Sprintf("%s %g was not tested", lowerName, a.load)
+			return result
+		}
+	} else {
+		var err error
+		if trials, where, err = r.predictedStep(); err != nil {
+			result.Detail = err.Error()
+			return result
+		}
+	}
+
+	trials, err := endpointResults(trials, r.Endpoint)
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	for _, res := range trials {
+		if a.metric == metricLatency && res.Latency(a.percentile) < 0 {
+			result.Detail = fmt.Sprintf("latency percentile %q is not available in the results", a.percentile)
+			return result
+		}
+	}
+	result.Actual = a.value(trials)
+	result.Passed = a.holds(result.Actual)
+	result.Detail = fmt.Sprintf("%s at %s", a.format(result.Actual), where)
+	return result
+}
+
+// predictedStep returns the trials that assertions without a step are checked
+// on, and where they ran: the check of the prediction, or else the highest
+// step tested up to the predicted load. Steps past the predicted load are
+// expected to miss the objectives.
+func (r *Report) predictedStep() ([]*TestResult, string, error) {
+	lowerName := strings.ToLower(r.LoadName())
+	if r.Check != nil {
+		return []*TestResult{r.Check}, fmt.Sprintf("the checked %s %g", lowerName, r.Check.Load()), nil
+	}
+	if r.Prediction == nil {
+		return nil, "", fmt.Errorf("no prediction was made to check at, give a step with \"at %s <load>\"", lowerName)
+	}
+	steps := groupByLoad(r.Results)
+	loads := sortedLoads(steps)
+	for i := len(loads) - 1; i >= 0; i-- {
+		if loads[i] <= r.Prediction.Load {
+			return steps[loads[i]], fmt.Sprintf("%s %g, the highest tested up to the predicted %.2f", lowerName, loads[i], r.Prediction.Load), nil
+		}
+	}
+	return nil, "", fmt.Errorf("no %s up to the predicted %.2f was tested", lowerName, r.Prediction.Load)
+}
+
+// LoadAssertions reads assertions from path, one per line. Blank lines and
+// lines starting with # are skipped.
+func LoadAssertions(path string) ([]*Assertion, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read assertions: %w", err)
+	}
+	assertions := []*Assertion{}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		assertion, err := ParseAssertion(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, i+1, err)
+		}
+		assertions = append(assertions, assertion)
+	}
+	return assertions, nil
+}
@@ -0,0 +1,90 @@
+package loadtest
+
+import "testing"
+
+func TestParseAssertion(t *testing.T) {
+	for _, test := range []struct {
+		expression string
+		metric     string
+		percentile LatencyPercentile
+		op         string
+		threshold  float64
+		loadName   string
+		load       float64
+	}{
+		{"p99 < 200ms at concurrency 50", metricLatency, Latency99, "<", 200, "concurrency", 50},
+		{"p99.9 <= 1.5s", metricLatency, "99.9%", "<=", 1500, "", 0},
+		{"avg < 20", metricLatency, LatencyAvg, "<", 20, "", 0},
+		{"  P90   <   80ms   AT   RATE   250  ", metricLatency, Latency90, "<", 80, "rate", 250},
+		{"p50 < 1e2ms at concurrency 1e2", metricLatency, Latency50, "<", 100, "concurrency", 100},
+		{"error rate < 0.1%", metricErrorRate, "", "<", 0.001, "", 0},
+		{"error rate <= 0.01 at rate 2.5e+2", metricErrorRate, "", "<=", 0.01, "rate", 250},
+		{"rps >= 500", metricThroughput, "", ">=", 500, "", 0},
+		{"throughput > 1e3rps at concurrency 10", metricThroughput, "", ">", 1000, "concurrency", 10},
+		{"predicted concurrency >= 120", metricPredictedLoad, "", ">=", 120, "", 0},
+		{"predicted rate > 300rps", metricPredictedLoad, "", ">", 300, "", 0},
+		{"predicted rps > 1000", metricPredictedRPS, "", ">", 1000, "", 0},
+	} {
+		a, err := ParseAssertion(test.expression)
+		if err != nil {
+			t.Errorf("ParseAssertion(%q): %v", test.expression, err)
+			continue
+		}
+		if a.metric != test.metric || a.percentile != test.percentile || a.op != test.op || a.threshold != test.threshold || a.loadName != test.loadName || a.load != test.load {
+			t.Errorf("ParseAssertion(%q) = %s %q %s %g at %q %g, want %s %q %s %g at %q %g", test.expression,
+				a.metric, a.percentile, a.op, a.threshold, a.loadName, a.load,
+				test.metric, test.percentile, test.op, test.threshold, test.loadName, test.load)
+		}
+	}
+
+	for _, expression := range []string{
+		"",
+		"p99",
+		"p99 = 200ms",
+		"p99 < fast",
+		"p99 < 200%",
+		"error rate < 5ms",
+		"latency < 200ms",
+		"p99 < 200ms at step 3",
+		"predicted concurrency >= 120 at concurrency 50",
+		"predicted concurrency >= 120ms",
+	} {
+		if _, err := ParseAssertion(expression); err == nil {
+			t.Errorf("ParseAssertion(%q) succeeded, want an error", expression)
+		}
+	}
+}
+
+func TestReportAssert(t *testing.T) {
+	runner := NewRunner(&fakeGenerator{}, 1, 60, Latency90, []int{10, 20, 40, 60, 80, 100}, false, false)
+	runner.BootstrapSamples = 0
+	runner.Progress = nil
+	report, err := runner.Run()
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	// The prediction is concurrency 70.7, so assertions without a step are
+	// checked at concurrency 60, where latency is 46ms, not at 100 (110ms)
+	for _, test := range []struct {
+		expression string
+		passed     bool
+	}{
+		{"p99 < 50ms", true},
+		{"p99 < 45ms", false},
+		{"p99 < 50ms at concurrency 100", false},
+		{"p99 < 50ms at concurrency 1e1", true},
+		{"p99 < 50ms at concurrency 30", false},
+		{"error rate < 0.1%", true},
+		{"predicted concurrency >= 70", true},
+		{"p99 < 50ms at rate 60", false},
+	} {
+		a, err := ParseAssertion(test.expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result := report.assert(a); result.Passed != test.passed {
+			t.Errorf("%q passed = %t, want %t: %s", test.expression, result.Passed, test.passed, result.Detail)
+		}
+	}
+}
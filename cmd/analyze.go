@@ -0,0 +1,157 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/palmdalian/loadtest"
+)
+
+// analyze re-runs the analysis over saved results, so a sweep can be
+// predicted for another target latency, percentile or model without
+// re-running it.
+func analyze(args []string) int {
+	defaults := loadtest.NewRunner(nil, 0, 0, "", nil, false, false)
+	flags := flag.NewFlagSet("analyze", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s analyze [flags] <results>...\n\nResults are JSON reports, results saved with -histograms (or their directory), or files of apib CSV lines.\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	targetLatency := flags.Int("target", 100, "Target latency (ms) for prediction")
+	percentile := flags.String("percentile", "90", "Latency percentile to predict on: 50, 90, 98, 99 or avg (any percentile such as 99.9 for results with histograms)")
+	model := flags.String("model", string(defaults.Model), "Model used for prediction (auto, quadratic, linear, exponential, power, piecewise or usl)")
+	endpoint := flags.String("endpoint", "", "Name of the corpus endpoint to predict on instead of the aggregate (optional)")
+	maxErrorRate := flags.Float64("max-error-rate", defaults.MaxErrorRate, "Highest fraction of failed or non-2xx requests allowed at the predicted load")
+	saturationThreshold := flags.Float64("saturation-threshold", defaults.SaturationThreshold, "Fraction of the first step's RPS per connection below which added connections count as saturated")
+	littlesTolerance := flags.Float64("littles-tolerance", defaults.LittlesLawTolerance, "Fraction by which the concurrency implied by Little's law may differ from the concurrency before a step is flagged")
+	weightBandwidth := flags.Float64("weight-bandwidth", defaults.WeightBandwidth, "Weight the fit towards steps with latency near the target, smaller is narrower (0 for an unweighted fit)")
+	maxCV := flags.Float64("max-cv", defaults.MaxCV, "Coefficient of variation of latency across trials above which a step is flagged as unstable")
+	bootstrapSamples := flags.Int("bootstrap", defaults.BootstrapSamples, "Number of bootstrap samples used to estimate confidence intervals (0 to disable)")
+	confidence := flags.Float64("confidence", defaults.Confidence, "Confidence level of the prediction intervals")
+	plotFlag := flags.Bool("plot", false, "Generate plots (latency.png and rps.png)")
+	var assertFlags repeatedFlag
+	flags.Var(&assertFlags, "assert", "Assertion such as \"p99 < 200ms at concurrency 50\", \"error rate < 0.1%\" or \"predicted concurrency >= 120\" (repeatable)")
+	assertionsFile := flags.String("assertions", "", "File of assertions to check, one per line (optional)")
+	output := flags.String("output", "text", "Format of the report: text, json or csv")
+	outFile := flags.String("out", "", "File to write the report to instead of stdout (optional)")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Println("Error: no results to analyze")
+		flags.Usage()
+		return exitError
+	}
+
+	if !slices.Contains(loadtest.OutputFormats, *output) {
+		fmt.Printf("Invalid output format: %s\n", *output)
+		flags.Usage()
+		return exitError
+	}
+
+	var progress io.Writer = os.Stdout
+	if *output != "text" && *outFile == "" {
+		progress = os.Stderr
+	}
+
+	// Whether a percentile is available depends on the results, see below
+	latencyPercentile, err := loadtest.ParseLatencyPercentile(*percentile, true)
+	if err != nil {
+		fmt.Printf("Invalid percentile: %v\n", err)
+		flags.Usage()
+		return exitError
+	}
+
+	if _, err := loadtest.NewModel(loadtest.ModelType(*model)); err != nil && loadtest.ModelType(*model) != loadtest.ModelAuto {
+		fmt.Printf("Invalid model: %v\n", err)
+		flags.Usage()
+		return exitError
+	}
+
+	if *maxErrorRate < 0 || *maxErrorRate > 1 {
+		fmt.Printf("Invalid max error rate: %g (must be between 0 and 1)\n", *maxErrorRate)
+		flags.Usage()
+		return exitError
+	}
+
+	if *confidence <= 0 || *confidence >= 1 {
+		fmt.Printf("Invalid confidence level: %g (must be between 0 and 1)\n", *confidence)
+		flags.Usage()
+		return exitError
+	}
+
+	assertions, err := loadAssertions(assertFlags, *assertionsFile)
+	if err != nil {
+		fmt.Printf("Invalid assertions: %v\n", err)
+		flags.Usage()
+		return exitError
+	}
+
+	results, err := loadtest.LoadResults(flags.Args()...)
+	if err != nil {
+		fmt.Fprintf(progress, "Failed to load results: %v\n", err)
+		return exitError
+	}
+	for _, result := range results {
+		if result.Latency(latencyPercentile) < 0 {
+			fmt.Fprintf(progress, "Latency percentile %q is not available in the results, only results with histograms support arbitrary percentiles\n", latencyPercentile)
+			return exitError
+		}
+	}
+	fmt.Fprintf(progress, "Loaded %d results\n", len(results))
+
+	runner := loadtest.NewRunner(nil, 0, *targetLatency, latencyPercentile, nil, false, *plotFlag)
+	runner.Endpoint = *endpoint
+	runner.Model = loadtest.ModelType(*model)
+	runner.MaxErrorRate = *maxErrorRate
+	runner.SaturationThreshold = *saturationThreshold
+	runner.LittlesLawTolerance = *littlesTolerance
+	runner.WeightBandwidth = *weightBandwidth
+	runner.MaxCV = *maxCV
+	runner.BootstrapSamples = *bootstrapSamples
+	runner.Confidence = *confidence
+	runner.Progress = progress
+
+	out := os.Stdout
+	if *outFile != "" {
+		f, err := os.Create(*outFile)
+		if err != nil {
+			fmt.Fprintf(progress, "Failed to create output file: %v\n", err)
+			return exitError
+		}
+		defer f.Close()
+		out = f
+	}
+
+	report, analyzeErr := runner.Analyze(results)
+	if analyzeErr == nil && *plotFlag {
+		if err := runner.PlotReport(report); err != nil {
+			fmt.Fprintf(progress, "Failed to plot results: %v\n", err)
+			return exitError
+		}
+	}
+	passed := report.Assert(assertions)
+	if err := report.Write(out, *output); err != nil {
+		fmt.Fprintf(progress, "Failed to write report: %v\n", err)
+		return exitError
+	}
+	if analyzeErr != nil {
+		fmt.Fprintf(progress, "Error analyzing results: %v\n", analyzeErr)
+		return exitError
+	}
+
+	if *output == "text" {
+		if report.LoadName() == "Rate" {
+			fmt.Fprintf(out, "\nPredicted rate: %s RPS\n", formatInterval(report.Prediction))
+		} else {
+			fmt.Fprintf(out, "\nPredicted concurrency level: %s\n", formatInterval(report.Prediction))
+		}
+	}
+	if !passed {
+		fmt.Fprintln(progress, "Assertions failed.")
+		return exitFailed
+	}
+	return exitOK
+}
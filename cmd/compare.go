@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/palmdalian/loadtest"
+)
+
+// compare compares a run against a baseline step by step, failing if it
+// regressed.
+func compare(args []string) int {
+	defaults := loadtest.NewCompareOptions()
+	flags := flag.NewFlagSet("compare", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s compare [flags] <baseline> <current>\n\nEach run is a JSON report, a result saved with -histograms (or their directory), or a file of apib CSV lines.\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	percentiles := flags.String("percentiles", "50,90,99", "Comma-separated latency percentiles to compare (any percentile such as 99.9 for results with histograms)")
+	maxLatencyIncrease := flags.Float64("max-latency-increase", defaults.MaxLatencyIncrease, "Largest allowed increase of any latency percentile, as a fraction of the baseline")
+	maxThroughputDrop := flags.Float64("max-throughput-drop", defaults.MaxThroughputDrop, "Largest allowed drop in throughput, as a fraction of the baseline")
+	significance := flags.Float64("significance", defaults.Significance, "P-value below which the Mann-Whitney U test finds latency increased, gating median and average latency regressions for results with histograms")
+	endpoint := flags.String("endpoint", "", "Name of the corpus endpoint to compare instead of the aggregate (optional)")
+	output := flags.String("output", "text", "Format of the comparison: text or json")
+	outFile := flags.String("out", "", "File to write the comparison to instead of stdout (optional)")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		fmt.Println("Error: compare needs a baseline and a current run")
+		flags.Usage()
+		return exitError
+	}
+
+	if *output != "text" && *output != "json" {
+		fmt.Printf("Invalid output format: %s\n", *output)
+		flags.Usage()
+		return exitError
+	}
+
+	options := loadtest.CompareOptions{
+		Endpoint:           *endpoint,
+		MaxLatencyIncrease: *maxLatencyIncrease,
+		MaxThroughputDrop:  *maxThroughputDrop,
+		Significance:       *significance,
+	}
+	for _, value := range strings.Split(*percentiles, ",") {
+		percentile, err := loadtest.ParseLatencyPercentile(value, true)
+		if err != nil {
+			fmt.Printf("Invalid percentile: %v\n", err)
+			flags.Usage()
+			return exitError
+		}
+		options.Percentiles = append(options.Percentiles, percentile)
+	}
+
+	var progress io.Writer = os.Stdout
+	if *output != "text" && *outFile == "" {
+		progress = os.Stderr
+	}
+
+	baseline, err := loadtest.LoadResults(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(progress, "Failed to load baseline: %v\n", err)
+		return exitError
+	}
+	current, err := loadtest.LoadResults(flags.Arg(1))
+	if err != nil {
+		fmt.Fprintf(progress, "Failed to load current run: %v\n", err)
+		return exitError
+	}
+	comparison, err := loadtest.CompareResults(baseline, current, options)
+	if err != nil {
+		fmt.Fprintf(progress, "Failed to compare runs: %v\n", err)
+		return exitError
+	}
+
+	out := os.Stdout
+	if *outFile != "" {
+		f, err := os.Create(*outFile)
+		if err != nil {
+			fmt.Fprintf(progress, "Failed to create output file: %v\n", err)
+			return exitError
+		}
+		out = f
+	}
+	if *output == "json" {
+		err = comparison.WriteJSON(out)
+	} else {
+		err = comparison.WriteText(out)
+	}
+	if err == nil && out != os.Stdout {
+		err = out.Close()
+	}
+	if err != nil {
+		fmt.Fprintf(progress, "Failed to write comparison: %v\n", err)
+		return exitError
+	}
+
+	if comparison.Regressed {
+		fmt.Fprintln(progress, "Performance regressed.")
+		return exitFailed
+	}
+	fmt.Fprintln(progress, "No regression.")
+	return exitOK
+}
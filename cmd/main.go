@@ -3,32 +3,125 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
+	"os"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/palmdalian/loadtest"
 )
 
+// Exit codes: failed means the tests ran but failed an assertion (or, for
+// compare, regressed), error means they could not run or be analyzed.
+const (
+	exitOK     = 0
+	exitFailed = 1
+	exitError  = 2
+)
+
+// repeatedFlag collects repeated flags such as -H
+type repeatedFlag []string
+
+func (h *repeatedFlag) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *repeatedFlag) Set(value string) error {
+	*h = append(*h, value)
+	return nil
+}
+
 func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "analyze":
+			return analyze(os.Args[2:])
+		case "compare":
+			return compare(os.Args[2:])
+		}
+	}
+
 	// Command-line flags
+	defaults := loadtest.NewRunner(nil, 0, 0, "", nil, false, false)
 	var url string
 	var duration int
 	var targetLatency int
 	flag.StringVar(&url, "url", "", "The URL to test (required)")
 	flag.IntVar(&duration, "duration", 10, "Duration of each test in seconds")
 	flag.IntVar(&targetLatency, "target", 100, "Target latency (ms) for prediction")
+	percentile := flag.String("percentile", "90", "Latency percentile to predict on: 50, 90, 98, 99 or avg (any percentile such as 99.9 with the native engine)")
+	model := flag.String("model", string(defaults.Model), "Model used for prediction (auto, quadratic, linear, exponential, power, piecewise or usl)")
 	concurrencyLevels := flag.String("concurrency", "1,2,10,50,100,200", "Comma-separated list of concurrency levels")
-	checkPrediction := flag.Bool("check", false, "Re-run apib to check prediction")
+	method := flag.String("method", "GET", "HTTP method to use")
+	var headers repeatedFlag
+	flag.Var(&headers, "H", "Request header as \"Name: value\" (repeatable)")
+	body := flag.String("body", "", "Request body (optional)")
+	bodyFile := flag.String("body-file", "", "File to read the request body from (optional)")
+	requestsFile := flag.String("requests", "", "JSONL request corpus to replay instead of a single request (native engine only)")
+	requestOrder := flag.String("order", "round-robin", "Order in which virtual users draw from the request corpus (round-robin or weighted)")
+	endpoint := flag.String("endpoint", "", "Name of the corpus endpoint to predict on instead of the aggregate (optional)")
+	dataFile := flag.String("data", "", "CSV or JSONL file of rows to render URL, header and body templates with (native engine only)")
+	dataMode := flag.String("data-mode", "sequential", "How rows are drawn from the data file (sequential, random or unique)")
+	rateLevels := flag.String("rate", "", "Comma-separated list of target RPS levels for open-loop testing (native engine only)")
+	engine := flag.String("engine", "apib", "Load generator engine (apib or native)")
+	histogramDir := flag.String("histograms", "", "Directory to save each step's result and latency histogram as JSON (optional)")
+	search := flag.Bool("search", false, "Search for the max concurrency meeting the target latency instead of testing -concurrency levels")
+	searchStart := flag.Int("search-start", defaults.SearchStart, "Concurrency to start the search at")
+	searchFactor := flag.Float64("search-factor", defaults.SearchFactor, "Factor to grow the concurrency by until the target latency is exceeded")
+	searchTolerance := flag.Int("search-tolerance", defaults.SearchTolerance, "Stop bisecting once the passing and failing concurrency are this close")
+	searchMax := flag.Int("search-max", defaults.SearchMax, "Maximum concurrency to search up to (0 for no limit)")
+	maxErrorRate := flag.Float64("max-error-rate", defaults.MaxErrorRate, "Highest fraction of failed or non-2xx requests allowed at the predicted load")
+	saturationThreshold := flag.Float64("saturation-threshold", defaults.SaturationThreshold, "Fraction of the first step's RPS per connection below which added connections count as saturated")
+	littlesTolerance := flag.Float64("littles-tolerance", defaults.LittlesLawTolerance, "Fraction by which the concurrency implied by Little's law may differ from -concurrency before a step is flagged")
+	weightBandwidth := flag.Float64("weight-bandwidth", defaults.WeightBandwidth, "Weight the fit towards steps with latency near the target, smaller is narrower (0 for an unweighted fit)")
+	repetitions := flag.Int("repetitions", defaults.Repetitions, "Number of trials to run at every concurrency level or rate")
+	maxCV := flag.Float64("max-cv", defaults.MaxCV, "Coefficient of variation of latency across trials above which a step is flagged as unstable")
+	bootstrapSamples := flag.Int("bootstrap", defaults.BootstrapSamples, "Number of bootstrap samples used to estimate confidence intervals (0 to disable)")
+	confidence := flag.Float64("confidence", defaults.Confidence, "Confidence level of the prediction intervals")
+	checkPrediction := flag.Bool("check", false, "Re-run the load generator to check prediction")
 	plotFlag := flag.Bool("plot", false, "Generate plots (latency.png and rps.png)")
+	var assertFlags repeatedFlag
+	flag.Var(&assertFlags, "assert", "Assertion such as \"p99 < 200ms at concurrency 50\", \"error rate < 0.1%\" or \"predicted concurrency >= 120\" (repeatable)")
+	assertionsFile := flag.String("assertions", "", "File of assertions to check, one per line (optional)")
+	output := flag.String("output", "text", "Format of the report: text, json or csv")
+	outFile := flag.String("out", "", "File to write the report to instead of stdout (optional)")
 	flag.Parse()
 
-	if url == "" {
+	if url == "" && *requestsFile == "" {
 		fmt.Println("Error: -url flag is required")
 		flag.Usage()
-		return
+		return exitError
 	}
 
-	fmt.Printf("Starting load tests for URL: %s\n", url)
+	if !slices.Contains(loadtest.OutputFormats, *output) {
+		fmt.Printf("Invalid output format: %s\n", *output)
+		flag.Usage()
+		return exitError
+	}
+
+	// Keep progress out of machine-readable reports written to stdout
+	var progress io.Writer = os.Stdout
+	if *output != "text" && *outFile == "" {
+		progress = os.Stderr
+	}
+
+	assertions, err := loadAssertions(assertFlags, *assertionsFile)
+	if err != nil {
+		fmt.Printf("Invalid assertions: %v\n", err)
+		flag.Usage()
+		return exitError
+	}
+
+	if *requestsFile != "" {
+		fmt.Fprintf(progress, "Starting load tests for requests in: %s\n", *requestsFile)
+	} else {
+		fmt.Fprintf(progress, "Starting load tests for URL: %s\n", url)
+	}
 
 	// Parse concurrency levels
 	concurrencyList := []int{}
@@ -37,19 +130,245 @@ func main() {
 		if err != nil {
 			fmt.Printf("Invalid concurrency level: %s\n", level)
 			flag.Usage()
-			return
+			return exitError
 		}
 		concurrencyList = append(concurrencyList, conc)
 	}
 
+	// Parse target rates
+	rateList := []float64{}
+	if *rateLevels != "" {
+		for _, level := range strings.Split(*rateLevels, ",") {
+			rate, err := strconv.ParseFloat(level, 64)
+			if err != nil || rate <= 0 {
+				fmt.Printf("Invalid rate level: %s\n", level)
+				flag.Usage()
+				return exitError
+			}
+			rateList = append(rateList, rate)
+		}
+	}
+
+	// Build the request to send
+	request := loadtest.NewRequest(url)
+	request.Method = strings.ToUpper(*method)
+	for _, header := range headers {
+		if err := request.AddHeader(header); err != nil {
+			fmt.Printf("Invalid header: %v\n", err)
+			flag.Usage()
+			return exitError
+		}
+	}
+	if *body != "" && *bodyFile != "" {
+		fmt.Println("Error: -body and -body-file cannot be used together")
+		flag.Usage()
+		return exitError
+	}
+	if *body != "" {
+		request.Body = []byte(*body)
+	}
+	if *bodyFile != "" {
+		data, err := os.ReadFile(*bodyFile)
+		if err != nil {
+			fmt.Printf("Failed to read body file: %v\n", err)
+			return exitError
+		}
+		request.Body = data
+	}
+
+	// Replay a corpus if one was given, relative paths resolve against -url
+	var source loadtest.RequestSource = request
+	if *requestsFile != "" {
+		corpus, err := loadtest.LoadCorpus(*requestsFile, url, loadtest.CorpusOrder(*requestOrder))
+		if err != nil {
+			fmt.Printf("Failed to load request corpus: %v\n", err)
+			return exitError
+		}
+		fmt.Fprintf(progress, "Loaded %d requests from %s\n", len(corpus.Requests), *requestsFile)
+		source = corpus
+	}
+
+	// Render templates with rows from the data file
+	if *dataFile != "" {
+		feeder, err := loadtest.LoadFeeder(*dataFile, loadtest.FeederMode(*dataMode))
+		if err != nil {
+			fmt.Printf("Failed to load data file: %v\n", err)
+			return exitError
+		}
+		fmt.Fprintf(progress, "Loaded %d rows from %s\n", len(feeder.Rows), *dataFile)
+		source = loadtest.NewTemplateSource(source, feeder)
+	}
+
+	var generator loadtest.LoadGenerator
+	switch *engine {
+	case "apib":
+		if *requestsFile != "" || *dataFile != "" {
+			fmt.Println("Error: -requests and -data are only supported by the native engine")
+			flag.Usage()
+			return exitError
+		}
+		apib := loadtest.NewAPIBGenerator(request)
+		apib.Progress = progress
+		generator = apib
+	case "native":
+		generator = loadtest.NewNativeGenerator(source)
+	default:
+		fmt.Printf("Invalid engine: %s\n", *engine)
+		flag.Usage()
+		return exitError
+	}
+
+	// The native engine records histograms, so any percentile can be used
+	latencyPercentile, err := loadtest.ParseLatencyPercentile(*percentile, *engine == "native")
+	if err != nil {
+		fmt.Printf("Invalid percentile: %v\n", err)
+		flag.Usage()
+		return exitError
+	}
+
+	if _, err := loadtest.NewModel(loadtest.ModelType(*model)); err != nil && loadtest.ModelType(*model) != loadtest.ModelAuto {
+		fmt.Printf("Invalid model: %v\n", err)
+		flag.Usage()
+		return exitError
+	}
+
+	if *maxErrorRate < 0 || *maxErrorRate > 1 {
+		fmt.Printf("Invalid max error rate: %g (must be between 0 and 1)\n", *maxErrorRate)
+		flag.Usage()
+		return exitError
+	}
+
+	if *repetitions < 1 {
+		fmt.Printf("Invalid repetitions: %d (must be at least 1)\n", *repetitions)
+		flag.Usage()
+		return exitError
+	}
+
+	if *confidence <= 0 || *confidence >= 1 {
+		fmt.Printf("Invalid confidence level: %g (must be between 0 and 1)\n", *confidence)
+		flag.Usage()
+		return exitError
+	}
+
 	// Run load tests
-	runner := loadtest.NewRunner(url, duration, targetLatency, loadtest.Latency90, concurrencyList, *checkPrediction, *plotFlag)
-	predictedConcurrency, err := runner.Run()
+	runner := loadtest.NewRunner(generator, duration, targetLatency, latencyPercentile, concurrencyList, *checkPrediction, *plotFlag)
+	runner.RateSteps = rateList
+	runner.HistogramDir = *histogramDir
+	runner.Endpoint = *endpoint
+	runner.Model = loadtest.ModelType(*model)
+	runner.SearchStart = *searchStart
+	runner.SearchFactor = *searchFactor
+	runner.SearchTolerance = *searchTolerance
+	runner.SearchMax = *searchMax
+	runner.MaxErrorRate = *maxErrorRate
+	runner.SaturationThreshold = *saturationThreshold
+	runner.LittlesLawTolerance = *littlesTolerance
+	runner.WeightBandwidth = *weightBandwidth
+	runner.Repetitions = *repetitions
+	runner.MaxCV = *maxCV
+	runner.BootstrapSamples = *bootstrapSamples
+	runner.Confidence = *confidence
+	runner.Progress = progress
+
+	out := os.Stdout
+	if *outFile != "" {
+		f, err := os.Create(*outFile)
+		if err != nil {
+			fmt.Fprintf(progress, "Failed to create output file: %v\n", err)
+			return exitError
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if *search {
+		result, err := runner.Search()
+		if result == nil {
+			fmt.Fprintf(progress, "Error running search: %v\n", err)
+			return exitError
+		}
+		passed := result.Report.Assert(assertions)
+		if err := result.Report.Write(out, *output); err != nil {
+			fmt.Fprintf(progress, "Failed to write report: %v\n", err)
+			return exitError
+		}
+		if err != nil {
+			fmt.Fprintf(progress, "Error running search: %v\n", err)
+			return exitError
+		}
+		if *output == "text" {
+			fmt.Fprintf(out, "\nMeasured max concurrency level: %d\n", result.MaxConcurrency)
+			if result.Report.Prediction != nil {
+				fmt.Fprintf(out, "Predicted concurrency level: %s\n", formatInterval(result.Report.Prediction))
+			}
+		}
+		return complete(progress, passed)
+	}
+
+	report, err := runner.Run()
+	passed := true
+	if report != nil {
+		passed = report.Assert(assertions)
+		if err := report.Write(out, *output); err != nil {
+			fmt.Fprintf(progress, "Failed to write report: %v\n", err)
+			return exitError
+		}
+	}
 	if err != nil {
-		fmt.Printf("Error running load tests: %v\n", err)
-		return
+		fmt.Fprintf(progress, "Error running load tests: %v\n", err)
+		return exitError
 	}
 
-	fmt.Printf("Predicted concurrency level: %.2f\n", predictedConcurrency)
-	fmt.Println("Tests complete.")
+	if *output == "text" {
+		if len(rateList) > 0 {
+			fmt.Fprintf(out, "\nPredicted rate: %s RPS\n", formatInterval(report.Prediction))
+		} else {
+			fmt.Fprintf(out, "\nPredicted concurrency level: %s\n", formatInterval(report.Prediction))
+		}
+	}
+	return complete(progress, passed)
+}
+
+// loadAssertions parses the -assert flags followed by the assertions in path
+func loadAssertions(expressions []string, path string) ([]*loadtest.Assertion, error) {
+	assertions := []*loadtest.Assertion{}
+	for _, expression := range expressions {
+		assertion, err := loadtest.ParseAssertion(expression)
+		if err != nil {
+			return nil, err
+		}
+		assertions = append(assertions, assertion)
+	}
+	if path != "" {
+		loaded, err := loadtest.LoadAssertions(path)
+		if err != nil {
+			return nil, err
+		}
+		assertions = append(assertions, loaded...)
+	}
+	return assertions, nil
+}
+
+// complete reports the end of the tests and returns the exit code for
+// whether the assertions passed
+func complete(progress io.Writer, passed bool) int {
+	if !passed {
+		fmt.Fprintln(progress, "Tests complete, assertions failed.")
+		return exitFailed
+	}
+	fmt.Fprintln(progress, "Tests complete.")
+	return exitOK
+}
+
+// formatInterval formats the predicted load with its confidence interval, if
+// one was estimated, and notes when the error rate limits it
+func formatInterval(prediction *loadtest.Prediction) string {
+	s := fmt.Sprintf("%.2f", prediction.Load)
+	if prediction.Samples > 0 {
+		s += fmt.Sprintf(" (%g%% CI %.2f - %.2f)", prediction.Confidence*100, prediction.LoadLow, prediction.LoadHigh)
+	}
+	if prediction.Constraint == "error rate" {
+		s += ", limited by error rate"
+	}
+	return s
 }
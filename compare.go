@@ -0,0 +1,309 @@
+package loadtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// CompareOptions configures CompareResults: what to compare and how much
+// worse the current run may be than the baseline before a step counts as
+// regressed.
+type CompareOptions struct {
+	// Endpoint, when set, compares the results for requests with this label
+	// instead of the aggregate over all requests.
+	Endpoint string
+	// Percentiles are the latencies compared at every step
+	Percentiles []LatencyPercentile
+	// MaxLatencyIncrease is the largest allowed increase of any of the
+	// Percentiles, as a fraction of the baseline
+	MaxLatencyIncrease float64
+	// MaxThroughputDrop is the largest allowed drop in throughput, as a
+	// fraction of the baseline
+	MaxThroughputDrop float64
+	// Significance is the p-value below which the Mann-Whitney U test finds
+	// the current latencies larger. Increases of the median and average
+	// latency above MaxLatencyIncrease only count as regressions when they
+	// are significant, if both runs recorded histograms to test. The test
+	// ranks the bulk of the requests, so it does not gate tail percentiles.
+	Significance float64
+}
+
+func NewCompareOptions() CompareOptions {
+	return CompareOptions{
+		Percentiles:        []LatencyPercentile{Latency50, Latency90, Latency99},
+		MaxLatencyIncrease: 0.1,
+		MaxThroughputDrop:  0.1,
+		Significance:       0.05,
+	}
+}
+
+// Comparison is the outcome of CompareResults
+type Comparison struct {
+	Steps []*StepComparison `json:"steps"`
+	// BaselineOnly and CurrentOnly list the loads only tested in one run
+	BaselineOnly []float64 `json:"baseline_only"`
+	CurrentOnly  []float64 `json:"current_only"`
+	// Regressed is set when any step regressed
+	Regressed bool   `json:"regressed"`
+	LoadName  string `json:"load_name"`
+}
+
+// StepComparison compares the baseline and current run at a single load.
+// Repeated trials are averaged.
+type StepComparison struct {
+	Load               float64              `json:"load"`
+	BaselineThroughput float64              `json:"baseline_throughput_rps"`
+	CurrentThroughput  float64              `json:"current_throughput_rps"`
+	ThroughputChange   float64              `json:"throughput_change"`
+	Latencies          []*LatencyComparison `json:"latencies"`
+	// PValue is the one-sided Mann-Whitney U test p-value for the current
+	// latencies being larger than the baseline's, -1 if either run has no
+	// histograms.
+	PValue float64 `json:"p_value"`
+	// Regressions describes every limit the step exceeded
+	Regressions []string `json:"regressions"`
+}
+
+// LatencyComparison compares a latency percentile (ms) between two runs
+type LatencyComparison struct {
+	Percentile LatencyPercentile `json:"percentile"`
+	Baseline   float64           `json:"baseline_ms"`
+	Current    float64           `json:"current_ms"`
+	Change     float64           `json:"change"`
+}
+
+// CompareResults aligns the steps of a baseline and current run by load and
+// checks every step shared by both against the limits in options.
+func CompareResults(baseline, current []*TestResult, options CompareOptions) (*Comparison, error) {
+	if len(baseline) == 0 || len(current) == 0 {
+		return nil, fmt.Errorf("both runs need results to compare")
+	}
+	baseline, err := endpointResults(baseline, options.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("baseline: %w", err)
+	}
+	if current, err = endpointResults(current, options.Endpoint); err != nil {
+		return nil, fmt.Errorf("current run: %w", err)
+	}
+	if baseline[0].LoadName() != current[0].LoadName() {
+		return nil, fmt.Errorf("cannot compare %s results with %s results", strings.ToLower(baseline[0].LoadName()), strings.ToLower(current[0].LoadName()))
+	}
+	for _, res := range append(baseline[:len(baseline):len(baseline)], current...) {
+		for _, percentile := range options.Percentiles {
+			if res.Latency(percentile) < 0 {
+				return nil, fmt.Errorf("latency percentile %q is not available at %s %g", percentile, strings.ToLower(res.LoadName()), res.Load())
+			}
+		}
+	}
+
+	baselineSteps, currentSteps := groupByLoad(baseline), groupByLoad(current)
+	comparison := &Comparison{
+		Steps:        []*StepComparison{},
+		BaselineOnly: []float64{},
+		CurrentOnly:  []float64{},
+		LoadName:     baseline[0].LoadName(),
+	}
+	for _, load := range sortedLoads(baselineSteps) {
+		if _, ok := currentSteps[load]; !ok {
+			comparison.BaselineOnly = append(comparison.BaselineOnly, load)
+		}
+	}
+	for _, load := range sortedLoads(currentSteps) {
+		trials, ok := baselineSteps[load]
+		if !ok {
+			comparison.CurrentOnly = append(comparison.CurrentOnly, load)
+			continue
+		}
+		step := compareStep(load, trials, currentSteps[load], options)
+		comparison.Steps = append(comparison.Steps, step)
+		comparison.Regressed = comparison.Regressed || len(step.Regressions) > 0
+	}
+	if len(comparison.Steps) == 0 {
+		return nil, fmt.Errorf("the runs have no %s in common", strings.ToLower(comparison.LoadName))
+	}
+	return comparison, nil
+}
+
+func groupByLoad(results []*TestResult) map[float64][]*TestResult {
+	steps := map[float64][]*TestResult{}
+	for _, res := range results {
+		steps[res.Load()] = append(steps[res.Load()], res)
+	}
+	return steps
+}
+
+func sortedLoads(steps map[float64][]*TestResult) []float64 {
+	loads := make([]float64, 0, len(steps))
+	for load := range steps {
+		loads = append(loads, load)
+	}
+	sort.Float64s(loads)
+	return loads
+}
+
+func compareStep(load float64, baseline, current []*TestResult, options CompareOptions) *StepComparison {
+	step := &StepComparison{Load: load, PValue: -1, Latencies: []*LatencyComparison{}, Regressions: []string{}}
+	step.BaselineThroughput = meanOf(baseline, func(res *TestResult) float64 { return res.Throughput })
+	step.CurrentThroughput = meanOf(current, func(res *TestResult) float64 { return res.Throughput })
+	step.ThroughputChange = relativeChange(step.BaselineThroughput, step.CurrentThroughput)
+
+	baselineHist, currentHist := mergedHistogram(baseline), mergedHistogram(current)
+	if baselineHist != nil && currentHist != nil {
+		step.PValue = mannWhitney(baselineHist, currentHist)
+	}
+	significant := step.PValue < 0 || step.PValue < options.Significance
+
+	if -step.ThroughputChange > options.MaxThroughputDrop {
+		step.Regressions = append(step.Regressions, fmt.Sprintf("throughput dropped %.1f%%", -step.ThroughputChange*100))
+	}
+	for _, percentile := range options.Percentiles {
+		latency := &LatencyComparison{
+			Percentile: percentile,
+			Baseline:   meanOf(baseline, func(res *TestResult) float64 { return res.Latency(percentile) }),
+			Current:    meanOf(current, func(res *TestResult) float64 { return res.Latency(percentile) }),
+		}
+		latency.Change = relativeChange(latency.Baseline, latency.Current)
+		step.Latencies = append(step.Latencies, latency)
+		gated := percentile == Latency50 || percentile == LatencyAvg
+		if latency.Change > options.MaxLatencyIncrease && (significant || !gated) {
+			step.Regressions = append(step.Regressions, fmt.Sprintf("%s latency rose %.1f%%", percentile, latency.Change*100))
+		}
+	}
+	return step
+}
+
+func meanOf(results []*TestResult, value func(*TestResult) float64) float64 {
+	sum := 0.0
+	for _, res := range results {
+		sum += value(res)
+	}
+	return sum / float64(len(results))
+}
+
+// relativeChange returns the change from baseline to current as a fraction
+// of baseline, 0 when there is no baseline to compare with.
+func relativeChange(baseline, current float64) float64 {
+	if baseline == 0 {
+		return 0
+	}
+	return (current - baseline) / baseline
+}
+
+// mergedHistogram merges the histograms of every trial, or returns nil if any
+// trial has none.
+func mergedHistogram(results []*TestResult) *Histogram {
+	merged := NewHistogram()
+	for _, res := range results {
+		if res.Histogram == nil {
+			return nil
+		}
+		merged.Merge(res.Histogram)
+	}
+	return merged
+}
+
+// mannWhitney returns the one-sided p-value of the Mann-Whitney U test that
+// latencies in current tend to be larger than in baseline, by the normal
+// approximation with tie and continuity correction. Latencies in the same
+// histogram bucket count as ties.
+func mannWhitney(baseline, current *Histogram) float64 {
+	n1, n2 := float64(current.Total), float64(baseline.Total)
+	if n1 == 0 || n2 == 0 {
+		return -1
+	}
+
+	indexes := map[int]bool{}
+	for index := range baseline.Counts {
+		indexes[index] = true
+	}
+	for index := range current.Counts {
+		indexes[index] = true
+	}
+	sorted := make([]int, 0, len(indexes))
+	for index := range indexes {
+		sorted = append(sorted, index)
+	}
+	sort.Ints(sorted)
+
+	// U counts the pairs in which the current latency is larger, ties as half
+	u, below, ties := 0.0, 0.0, 0.0
+	for _, index := range sorted {
+		b, c := float64(baseline.Counts[index]), float64(current.Counts[index])
+		u += c * (below + b/2)
+		below += b
+		t := b + c
+		ties += t*t*t - t
+	}
+
+	n := n1 + n2
+	mean := n1 * n2 / 2
+	variance := n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1)))
+	if variance <= 0 {
+		return 1
+	}
+	z := (u - mean - 0.5) / math.Sqrt(variance)
+	return 0.5 * math.Erfc(z/math.Sqrt2)
+}
+
+// WriteJSON writes the comparison as a JSON document with the schema version
+// of the other JSON output.
+func (c *Comparison) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(struct {
+		SchemaVersion int `json:"schema_version"`
+		*Comparison
+	}{SchemaVersion, c})
+	if err != nil {
+		return fmt.Errorf("failed to encode comparison: %w", err)
+	}
+	return nil
+}
+
+// WriteText writes the comparison as a table with a line per regressed step
+func (c *Comparison) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\tRPS\t", c.LoadName)
+	if len(c.Steps) > 0 {
+		for _, latency := range c.Steps[0].Latencies {
+			fmt.Fprintf(tw, "%s Latency (ms)\t", latency.Percentile)
+		}
+	}
+	fmt.Fprintf(tw, "p-value\t\n")
+	for _, step := range c.Steps {
+		fmt.Fprintf(tw, "%g\t%.2f → %.2f (%+.1f%%)\t", step.Load, step.BaselineThroughput, step.CurrentThroughput, step.ThroughputChange*100)
+		for _, latency := range step.Latencies {
+			fmt.Fprintf(tw, "%.2f → %.2f (%+.1f%%)\t", latency.Baseline, latency.Current, latency.Change*100)
+		}
+		pValue := "-"
+		if step.PValue >= 0 {
+			pValue = fmt.Sprintf("%.3g", step.PValue)
+		}
+		outcome := ""
+		if len(step.Regressions) > 0 {
+			outcome = "regressed"
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", pValue, outcome)
+	}
+	tw.Flush()
+
+	lowerName := strings.ToLower(c.LoadName)
+	for _, load := range c.BaselineOnly {
+		fmt.Fprintf(w, "Warning: %s %g is only in the baseline\n", lowerName, load)
+	}
+	for _, load := range c.CurrentOnly {
+		fmt.Fprintf(w, "Warning: %s %g is only in the current run\n", lowerName, load)
+	}
+	for _, step := range c.Steps {
+		if len(step.Regressions) > 0 {
+			fmt.Fprintf(w, "Regression at %s %g: %s\n", lowerName, step.Load, strings.Join(step.Regressions, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package loadtest
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// histogramOf records latencies given in ms
+func histogramOf(latencies ...float64) *Histogram {
+	h := NewHistogram()
+	for _, latency := range latencies {
+		h.Record(latency)
+	}
+	return h
+}
+
+func TestMannWhitney(t *testing.T) {
+	for _, test := range []struct {
+		name              string
+		baseline, current *Histogram
+		low, high         float64
+	}{
+		{"empty baseline", NewHistogram(), histogramOf(1, 2), -1, -1},
+		{"empty current", histogramOf(1, 2), NewHistogram(), -1, -1},
+		// Every latency tied leaves nothing to rank
+		{"all ties", histogramOf(5, 5, 5), histogramOf(5, 5), 1, 1},
+		{"identical", histogramOf(1, 2, 3, 4, 5), histogramOf(1, 2, 3, 4, 5), 0.5, 0.6},
+		// U = 9 of 9 pairs, z = (9 - 4.5 - 0.5) / √5.25
+		{"shifted", histogramOf(1, 2, 3), histogramOf(4, 5, 6), 0.0403, 0.0405},
+		// U = 8 with ties at 2ms, z = (8 - 4.5 - 0.5) / √4.5
+		{"shifted with ties", histogramOf(1, 2, 2), histogramOf(2, 3, 3), 0.0785, 0.0787},
+		// U = 0, z = (0 - 4.5 - 0.5) / √5.25
+		{"shifted down", histogramOf(4, 5, 6), histogramOf(1, 2, 3), 0.9854, 0.9855},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if p := mannWhitney(test.baseline, test.current); p < test.low || p > test.high {
+				t.Errorf("p = %g, want between %g and %g", p, test.low, test.high)
+			}
+		})
+	}
+
+	// A large clear shift is significant
+	baseline, current := NewHistogram(), NewHistogram()
+	for i := 0; i < 1000; i++ {
+		baseline.Record(10 + float64(i%10))
+		current.Record(12 + float64(i%10))
+	}
+	if p := mannWhitney(baseline, current); p > 1e-6 {
+		t.Errorf("p = %g for a 2ms shift of 1000 requests, want below 1e-6", p)
+	}
+}
+
+func TestCompareStepGating(t *testing.T) {
+	result := func(h *Histogram) *TestResult {
+		res := &TestResult{Connections: 10, Throughput: 100}
+		res.SetHistograms(h, nil)
+		return res
+	}
+	p999, err := ParseLatencyPercentile("99.9", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := NewCompareOptions()
+	options.Percentiles = []LatencyPercentile{Latency50, p999}
+
+	// The median doubles in too few requests to be significant
+	step := compareStep(10, []*TestResult{result(histogramOf(10, 10, 20))}, []*TestResult{result(histogramOf(10, 20, 20))}, options)
+	if len(step.Regressions) != 0 {
+		t.Errorf("insignificant median increase flagged: %v (p = %g)", step.Regressions, step.PValue)
+	}
+
+	// The slowest requests double while the bulk is unchanged
+	baseline, current := NewHistogram(), NewHistogram()
+	baseline.RecordN(10, 990)
+	baseline.RecordN(100, 10)
+	current.RecordN(10, 990)
+	current.RecordN(200, 10)
+	step = compareStep(10, []*TestResult{result(baseline)}, []*TestResult{result(current)}, options)
+	if step.PValue < options.Significance {
+		t.Fatalf("p = %g, want the tail shift to be insignificant to the rank test", step.PValue)
+	}
+	if len(step.Regressions) != 1 || !strings.HasPrefix(step.Regressions[0], string(p999)) {
+		t.Errorf("regressions = %v, want the %s latency", step.Regressions, p999)
+	}
+	if change := step.Latencies[1].Change; math.Abs(change-1) > 0.01 {
+		t.Errorf("%s latency change = %g, want 1", p999, change)
+	}
+}
@@ -0,0 +1,185 @@
+package loadtest
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Prediction is the load predicted to reach the target latency, with
+// bootstrap confidence intervals.
+type Prediction struct {
+	// Model is the model the prediction was made with
+	Model ModelType `json:"model"`
+	// Load is the predicted concurrency, or rate for open-loop tests
+	Load     float64 `json:"load"`
+	LoadLow  float64 `json:"load_low"`
+	LoadHigh float64 `json:"load_high"`
+	// RPS is the throughput interpolated at Load
+	RPS     float64 `json:"rps"`
+	RPSLow  float64 `json:"rps_low"`
+	RPSHigh float64 `json:"rps_high"`
+	// Confidence is the level of the intervals, e.g. 0.95
+	Confidence float64 `json:"confidence"`
+	// Samples is the number of bootstrap samples the intervals are based
+	// on, 0 if they could not be estimated.
+	Samples      int                   `json:"samples"`
+	Coefficients []CoefficientInterval `json:"coefficients"`
+
+	// LatencyLoad is the load predicted from latency alone, 0 if it could
+	// not be predicted. ErrorRateLoad is the load at which the error rate
+	// exceeds the limit, 0 if it never did. Constraint names the one that
+	// bounds Load: "latency" or "error rate".
+	LatencyLoad   float64 `json:"latency_load"`
+	ErrorRateLoad float64 `json:"error_rate_load"`
+	Constraint    string  `json:"constraint"`
+	// Excluded lists the loads of steps left out of the fit for exceeding
+	// the error rate limit.
+	Excluded []float64 `json:"excluded"`
+
+	// SaturationLoad is the load above which throughput stops scaling, with
+	// SaturationRPS the throughput there. KneeLoad is the knee of the latency
+	// curve, with KneeLatency the latency (ms) there. Both are 0 if not found.
+	SaturationLoad float64 `json:"saturation_load"`
+	SaturationRPS  float64 `json:"saturation_rps"`
+	KneeLoad       float64 `json:"knee_load"`
+	KneeLatency    float64 `json:"knee_latency_ms"`
+}
+
+// CoefficientInterval is a fitted coefficient with its confidence interval
+type CoefficientInterval struct {
+	Coefficient
+	Low  float64 `json:"low"`
+	High float64 `json:"high"`
+}
+
+// bootstrapPrediction estimates confidence intervals on the coefficients of
+// model, the load it predicts at targetLatency and the throughput there by
+// residual bootstrap: the model is refitted to its own fitted values plus
+// residuals resampled with replacement. Models that also fit throughput get
+// their throughput residuals resampled alongside. Samples whose refit or
+// prediction fails are dropped.
+func bootstrapPrediction(model Model, targetLatency int, latencyPercentile LatencyPercentile, bandwidth float64, results []*TestResult, load float64, samples int, confidence float64) (*Prediction, error) {
+	observations, err := observationsFor(results, latencyPercentile, targetLatency, bandwidth)
+	if err != nil {
+		return nil, err
+	}
+	rps, err := interpolateThroughput(results, load)
+	if err != nil {
+		return nil, fmt.Errorf("failed to interpolate throughput: %w", err)
+	}
+
+	coefficients := model.Coefficients()
+	prediction := &Prediction{
+		Model:        model.Name(),
+		Load:         load,
+		LoadLow:      load,
+		LoadHigh:     load,
+		RPS:          rps,
+		RPSLow:       rps,
+		RPSHigh:      rps,
+		Confidence:   confidence,
+		Coefficients: make([]CoefficientInterval, len(coefficients)),
+		Excluded:     []float64{},
+	}
+	for i, c := range coefficients {
+		prediction.Coefficients[i] = CoefficientInterval{Coefficient: c, Low: c.Value, High: c.Value}
+	}
+	if samples <= 0 {
+		return prediction, nil
+	}
+
+	throughputModel, fitsThroughput := model.(ThroughputModel)
+	latencyResiduals := make([]float64, len(observations))
+	throughputResiduals := make([]float64, len(observations))
+	for i, o := range observations {
+		latencyResiduals[i] = o.Latency - model.Predict(o.Load)
+		if fitsThroughput {
+			throughputResiduals[i] = o.Throughput - throughputModel.Throughput(o.Load)
+		}
+	}
+
+	// Interpolating RPS needs a load within the observed range
+	minLoad, maxLoad := results[0].Load(), results[len(results)-1].Load()
+
+	// A fixed seed keeps the intervals reproducible for the same results
+	rng := rand.New(rand.NewSource(1))
+	loads := []float64{}
+	throughputs := []float64{}
+	values := make([][]float64, len(coefficients))
+	resampled := make([]Observation, len(observations))
+	for s := 0; s < samples; s++ {
+		for i, o := range observations {
+			j := rng.Intn(len(observations))
+			resampled[i] = o
+			resampled[i].Latency = model.Predict(o.Load) + latencyResiduals[j]
+			if fitsThroughput {
+				resampled[i].Throughput = throughputModel.Throughput(o.Load) + throughputResiduals[j]
+			}
+		}
+
+		refit, err := NewModel(model.Name())
+		if err != nil {
+			return nil, err
+		}
+		if err := refit.Fit(resampled); err != nil {
+			continue
+		}
+		predicted, err := refit.Solve(float64(targetLatency))
+		if err != nil || math.IsNaN(predicted) || math.IsInf(predicted, 0) {
+			continue
+		}
+		sampleRPS, err := interpolateThroughput(results, math.Max(minLoad, math.Min(maxLoad, predicted)))
+		if err != nil {
+			continue
+		}
+
+		loads = append(loads, predicted)
+		throughputs = append(throughputs, sampleRPS)
+		for i, c := range refit.Coefficients() {
+			values[i] = append(values[i], c.Value)
+		}
+	}
+
+	// Too few successful refits make the percentiles meaningless
+	if len(loads) == 0 || len(loads) < samples/2 {
+		return nil, fmt.Errorf("only %d of %d bootstrap samples could be refitted", len(loads), samples)
+	}
+
+	prediction.Samples = len(loads)
+	prediction.LoadLow, prediction.LoadHigh = percentileInterval(loads, confidence)
+	prediction.RPSLow, prediction.RPSHigh = percentileInterval(throughputs, confidence)
+	for i := range prediction.Coefficients {
+		prediction.Coefficients[i].Low, prediction.Coefficients[i].High = percentileInterval(values[i], confidence)
+	}
+	return prediction, nil
+}
+
+// percentileInterval returns the central confidence interval of samples
+func percentileInterval(samples []float64, confidence float64) (float64, float64) {
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+	alpha := (1 - confidence) / 2
+	return quantile(sorted, alpha), quantile(sorted, 1-alpha)
+}
+
+// quantile linearly interpolates the q-quantile of sorted samples
+func quantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	i := int(pos)
+	if i >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (sorted[i+1]-sorted[i])*(pos-float64(i))
+}
+
+// describeCoefficients formats the coefficient intervals, one per line
+func (p *Prediction) describeCoefficients() string {
+	lines := make([]string, len(p.Coefficients))
+	for i, c := range p.Coefficients {
+		lines[i] = fmt.Sprintf("  %s = %.4g [%.4g, %.4g]", c.Name, c.Value, c.Low, c.High)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,220 @@
+package loadtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type CorpusOrder string
+
+const (
+	CorpusRoundRobin CorpusOrder = "round-robin"
+	CorpusWeighted   CorpusOrder = "weighted"
+)
+
+// Corpus is a set of requests replayed by every virtual user, either in turn
+// or drawn at random in proportion to their weights.
+type Corpus struct {
+	Requests []*Request
+	Weights  []float64
+	Order    CorpusOrder
+}
+
+// corpusEntry is one line of a JSONL request corpus, e.g.
+//
+//	{"name": "create order", "method": "POST", "path": "/orders", "headers": {"Content-Type": "application/json"}, "body": {"id": 1}, "weight": 2}
+//
+// name labels the endpoint in per-endpoint results and defaults to the method
+// and URL path, e.g. "POST /orders". url is used as is, otherwise path is
+// resolved against the base URL. body may be a JSON string, which is sent
+// verbatim, or any other JSON value, which is sent as encoded. weight defaults
+// to 1. The URL, path, header values and body may contain templates rendered
+// by a TemplateSource.
+type corpusEntry struct {
+	Name    string            `json:"name"`
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+	Weight  *float64          `json:"weight"`
+}
+
+// LoadCorpus reads a JSONL request corpus from path, resolving relative paths
+// against baseURL.
+func LoadCorpus(path, baseURL string, order CorpusOrder) (*Corpus, error) {
+	if order != CorpusRoundRobin && order != CorpusWeighted {
+		return nil, fmt.Errorf("invalid corpus order %q", order)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open request corpus: %w", err)
+	}
+	defer f.Close()
+
+	var base *url.URL
+	if baseURL != "" {
+		if base, err = url.Parse(baseURL); err != nil {
+			return nil, fmt.Errorf("invalid base URL: %w", err)
+		}
+	}
+
+	corpus := &Corpus{Order: order}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		req, weight, err := parseCorpusEntry([]byte(text), base)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		corpus.Requests = append(corpus.Requests, req)
+		corpus.Weights = append(corpus.Weights, weight)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read request corpus: %w", err)
+	}
+	if len(corpus.Requests) == 0 {
+		return nil, fmt.Errorf("no requests found in %s", path)
+	}
+
+	return corpus, nil
+}
+
+func parseCorpusEntry(data []byte, base *url.URL) (*Request, float64, error) {
+	var entry corpusEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, 0, fmt.Errorf("invalid request: %w", err)
+	}
+
+	target := entry.URL
+	if target == "" {
+		if entry.Path == "" {
+			return nil, 0, fmt.Errorf("request has neither url nor path")
+		}
+		if base == nil {
+			return nil, 0, fmt.Errorf("request path %q requires a base URL", entry.Path)
+		}
+		ref, err := url.Parse(entry.Path)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid path %q: %w", entry.Path, err)
+		}
+		resolved := base.ResolveReference(ref)
+		target = resolved.String()
+		if isTemplate(entry.Path) {
+			// Keep template actions unescaped so they can still be rendered
+			target = resolved.Scheme + "://" + resolved.Host + resolved.Path
+			if resolved.RawQuery != "" {
+				target += "?" + resolved.RawQuery
+			}
+		}
+	}
+
+	req := NewRequest(target)
+	if entry.Method != "" {
+		req.Method = strings.ToUpper(entry.Method)
+	}
+	for name, value := range entry.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Label = entry.Name
+	if req.Label == "" {
+		u, err := url.Parse(target)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid url %q: %w", target, err)
+		}
+		path := u.Path
+		if path == "" {
+			path = "/"
+		}
+		req.Label = req.Method + " " + path
+	}
+
+	body := bytes.TrimSpace(entry.Body)
+	if len(body) > 0 && !bytes.Equal(body, []byte("null")) {
+		var s string
+		if err := json.Unmarshal(body, &s); err == nil {
+			req.Body = []byte(s)
+		} else {
+			req.Body = body
+		}
+	}
+
+	weight := 1.0
+	if entry.Weight != nil {
+		weight = *entry.Weight
+	}
+	if weight < 0 {
+		return nil, 0, fmt.Errorf("negative weight %g", weight)
+	}
+
+	// Templated URLs are only valid once rendered
+	if !isTemplate(req.URL) {
+		if _, err := http.NewRequest(req.Method, req.URL, nil); err != nil {
+			return nil, 0, fmt.Errorf("invalid request: %w", err)
+		}
+	}
+	return req, weight, nil
+}
+
+func isTemplate(s string) bool {
+	return strings.Contains(s, "{{")
+}
+
+func (c *Corpus) NewUser(id int) RequestIterator {
+	if c.Order == CorpusWeighted {
+		cumulative := make([]float64, len(c.Weights))
+		total := 0.0
+		for i, weight := range c.Weights {
+			total += weight
+			cumulative[i] = total
+		}
+		return &weightedIterator{
+			corpus:     c,
+			cumulative: cumulative,
+			rng:        rand.New(rand.NewSource(time.Now().UnixNano() + int64(id))),
+		}
+	}
+	// Start each user at a different offset so they don't move in lockstep
+	return &roundRobinIterator{corpus: c, next: id % len(c.Requests)}
+}
+
+type roundRobinIterator struct {
+	corpus *Corpus
+	next   int
+}
+
+func (it *roundRobinIterator) Next() (*Request, error) {
+	req := it.corpus.Requests[it.next]
+	it.next = (it.next + 1) % len(it.corpus.Requests)
+	return req, nil
+}
+
+type weightedIterator struct {
+	corpus     *Corpus
+	cumulative []float64
+	rng        *rand.Rand
+}
+
+func (it *weightedIterator) Next() (*Request, error) {
+	total := it.cumulative[len(it.cumulative)-1]
+	if total <= 0 {
+		return nil, fmt.Errorf("request corpus has no positive weights")
+	}
+	target := it.rng.Float64() * total
+	i := sort.Search(len(it.cumulative), func(i int) bool { return it.cumulative[i] > target })
+	return it.corpus.Requests[i], nil
+}
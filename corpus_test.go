@@ -0,0 +1,133 @@
+package loadtest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTemp writes content to name in a temporary directory and returns its
+// path
+func writeTemp(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadCorpus(t *testing.T) {
+	path := writeTemp(t, "corpus.jsonl", `{"url": "http://other.example/health"}
+
+{"name": "create order", "method": "post", "path": "/orders", "headers": {"Content-Type": "application/json"}, "body": {"id": 1}, "weight": 2}
+{"path": "/search?q=x", "body": "plain text", "weight": 0}
+{"path": "/items/{{.id}}"}
+`)
+	corpus, err := LoadCorpus(path, "http://api.example/v1/", CorpusRoundRobin)
+	if err != nil {
+		t.Fatalf("LoadCorpus: %v", err)
+	}
+
+	for i, want := range []struct {
+		label, method, url, body, contentType string
+		weight                                float64
+	}{
+		{"GET /health", "GET", "http://other.example/health", "", "", 1},
+		{"create order", "POST", "http://api.example/orders", `{"id": 1}`, "application/json", 2},
+		{"GET /search", "GET", "http://api.example/search?q=x", "plain text", "", 0},
+		{"GET /items/{{.id}}", "GET", "http://api.example/items/{{.id}}", "", "", 1},
+	} {
+		if i >= len(corpus.Requests) {
+			t.Fatalf("got %d requests, want 4", len(corpus.Requests))
+		}
+		req := corpus.Requests[i]
+		if req.Label != want.label || req.Method != want.method || req.URL != want.url || string(req.Body) != want.body || req.Header.Get("Content-Type") != want.contentType {
+			t.Errorf("request %d = %q %s %s %q %q, want %q %s %s %q %q", i, req.Label, req.Method, req.URL, req.Body, req.Header.Get("Content-Type"),
+				want.label, want.method, want.url, want.body, want.contentType)
+		}
+		if corpus.Weights[i] != want.weight {
+			t.Errorf("request %d weight = %g, want %g", i, corpus.Weights[i], want.weight)
+		}
+	}
+}
+
+func TestLoadCorpusErrors(t *testing.T) {
+	for _, test := range []struct {
+		name, content, baseURL string
+		order                  CorpusOrder
+		want                   string
+	}{
+		{"order", `{"url": "http://a.example/"}`, "", "random", "invalid corpus order"},
+		{"empty", "\n\n", "", CorpusRoundRobin, "no requests found"},
+		{"json", `{"url": `, "", CorpusRoundRobin, ":1: invalid request"},
+		{"no url", `{"method": "GET"}`, "", CorpusRoundRobin, "neither url nor path"},
+		{"no base", `{"path": "/a"}`, "", CorpusRoundRobin, "requires a base URL"},
+		{"weight", "{\"url\": \"http://a.example/\"}\n{\"url\": \"http://a.example/\", \"weight\": -1}", "", CorpusWeighted, ":2: negative weight"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeTemp(t, "corpus.jsonl", test.content)
+			_, err := LoadCorpus(path, test.baseURL, test.order)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestCorpusRoundRobin(t *testing.T) {
+	corpus := &Corpus{
+		Requests: []*Request{NewRequest("http://a.example/0"), NewRequest("http://a.example/1"), NewRequest("http://a.example/2")},
+		Weights:  []float64{1, 1, 1},
+		Order:    CorpusRoundRobin,
+	}
+	// Every user cycles through the corpus from its own offset
+	for _, test := range []struct {
+		user int
+		want []int
+	}{
+		{0, []int{0, 1, 2, 0, 1}},
+		{1, []int{1, 2, 0, 1, 2}},
+		{5, []int{2, 0, 1, 2, 0}},
+	} {
+		user := corpus.NewUser(test.user)
+		for i, want := range test.want {
+			req, err := user.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if req != corpus.Requests[want] {
+				t.Errorf("user %d request %d = %s, want %s", test.user, i, req.URL, corpus.Requests[want].URL)
+			}
+		}
+	}
+}
+
+func TestCorpusWeighted(t *testing.T) {
+	corpus := &Corpus{
+		Requests: []*Request{NewRequest("http://a.example/0"), NewRequest("http://a.example/1"), NewRequest("http://a.example/2")},
+		Weights:  []float64{1, 0, 3},
+		Order:    CorpusWeighted,
+	}
+	counts := map[*Request]int{}
+	user := corpus.NewUser(0)
+	for i := 0; i < 4000; i++ {
+		req, err := user.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[req]++
+	}
+	if counts[corpus.Requests[1]] != 0 {
+		t.Errorf("drew the zero-weight request %d times", counts[corpus.Requests[1]])
+	}
+	if share := float64(counts[corpus.Requests[2]]) / 4000; share < 0.7 || share > 0.8 {
+		t.Errorf("drew the weight 3 request %.1f%% of the time, want 75%%", share*100)
+	}
+
+	corpus.Weights = []float64{0, 0, 0}
+	if _, err := corpus.NewUser(0).Next(); err == nil {
+		t.Errorf("drew from a corpus without positive weights")
+	}
+}
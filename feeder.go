@@ -0,0 +1,135 @@
+package loadtest
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type FeederMode string
+
+const (
+	// FeedSequential cycles through the rows in file order
+	FeedSequential FeederMode = "sequential"
+	// FeedRandom picks a random row for every request
+	FeedRandom FeederMode = "random"
+	// FeedUnique uses every row at most once. The step that runs out of rows
+	// ends early and the remaining steps are skipped.
+	FeedUnique FeederMode = "unique"
+)
+
+// Feeder hands out rows of template data shared by all virtual users. Rows
+// are loaded from a CSV file with a header row, or from a JSONL file of
+// objects.
+type Feeder struct {
+	Rows []map[string]any
+	Mode FeederMode
+
+	mu   sync.Mutex
+	next int
+	rng  *rand.Rand
+}
+
+// LoadFeeder reads rows from path, as JSONL when it ends in .jsonl or .json
+// and as CSV otherwise.
+func LoadFeeder(path string, mode FeederMode) (*Feeder, error) {
+	if mode != FeedSequential && mode != FeedRandom && mode != FeedUnique {
+		return nil, fmt.Errorf("invalid feeder mode %q", mode)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open data file: %w", err)
+	}
+	defer f.Close()
+
+	var rows []map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".json":
+		rows, err = readJSONLRows(f)
+	default:
+		rows, err = readCSVRows(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data file %s: %w", path, err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no rows found in data file %s", path)
+	}
+
+	return &Feeder{
+		Rows: rows,
+		Mode: mode,
+		rng:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+func readCSVRows(f *os.File) ([]map[string]any, error) {
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, nil
+	}
+
+	header := records[0]
+	rows := make([]map[string]any, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]any, len(header))
+		for i, name := range header {
+			row[strings.TrimSpace(name)] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func readJSONLRows(f *os.File) ([]map[string]any, error) {
+	rows := []map[string]any{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		row := map[string]any{}
+		if err := json.Unmarshal([]byte(text), &row); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+// Next returns the next row according to the feeder mode
+func (f *Feeder) Next() (map[string]any, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch f.Mode {
+	case FeedRandom:
+		return f.Rows[f.rng.Intn(len(f.Rows))], nil
+	case FeedUnique:
+		if f.next >= len(f.Rows) {
+			return nil, fmt.Errorf("%w: data feeder ran out after %d unique rows", ErrSourceExhausted, len(f.Rows))
+		}
+	}
+	row := f.Rows[f.next%len(f.Rows)]
+	f.next++
+	return row, nil
+}
+
+// Sample returns a row without drawing it, for requests that are not part of
+// a test such as the warmup
+func (f *Feeder) Sample() map[string]any {
+	return f.Rows[0]
+}
@@ -0,0 +1,111 @@
+package loadtest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLoadFeeder(t *testing.T) {
+	for _, test := range []struct {
+		name, content string
+		want          []map[string]any
+	}{
+		{"rows.csv", "id, name\n1,a\n2,\"b, c\"\n", []map[string]any{{"id": "1", "name": "a"}, {"id": "2", "name": "b, c"}}},
+		{"rows.jsonl", "{\"id\": 1, \"tags\": [\"x\"]}\n\n{\"id\": 2}\n", []map[string]any{{"id": 1.0, "tags": []any{"x"}}, {"id": 2.0}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			feeder, err := LoadFeeder(writeTemp(t, test.name, test.content), FeedSequential)
+			if err != nil {
+				t.Fatalf("LoadFeeder: %v", err)
+			}
+			if len(feeder.Rows) != len(test.want) {
+				t.Fatalf("got %d rows, want %d", len(feeder.Rows), len(test.want))
+			}
+			for i, row := range feeder.Rows {
+				for key, value := range test.want[i] {
+					if got := row[key]; !equalValues(got, value) {
+						t.Errorf("row %d %s = %#v, want %#v", i, key, got, value)
+					}
+				}
+			}
+		})
+	}
+
+	for _, test := range []struct {
+		name, content string
+		mode          FeederMode
+		want          string
+	}{
+		{"rows.csv", "id\n1\n", "shuffled", "invalid feeder mode"},
+		{"rows.csv", "id\n", FeedSequential, "no rows found"},
+		{"rows.jsonl", "{\"id\": 1}\nnot json\n", FeedSequential, "line 2"},
+	} {
+		_, err := LoadFeeder(writeTemp(t, test.name, test.content), test.mode)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("LoadFeeder(%q, %s): got %v, want an error containing %q", test.content, test.mode, err, test.want)
+		}
+	}
+}
+
+// equalValues compares the scalars and lists of scalars rows are made of
+func equalValues(a, b any) bool {
+	as, aok := a.([]any)
+	bs, bok := b.([]any)
+	if aok || bok {
+		if !aok || !bok || len(as) != len(bs) {
+			return false
+		}
+		for i := range as {
+			if as[i] != bs[i] {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+func TestFeederNext(t *testing.T) {
+	rows := []map[string]any{{"id": 0}, {"id": 1}, {"id": 2}}
+	for _, test := range []struct {
+		mode FeederMode
+		want []int
+	}{
+		{FeedSequential, []int{0, 1, 2, 0, 1, 2, 0}},
+		{FeedUnique, []int{0, 1, 2, -1, -1}},
+	} {
+		feeder := &Feeder{Rows: rows, Mode: test.mode}
+		if feeder.Sample()["id"] != 0 {
+			t.Errorf("%s: Sample() = %v, want the first row", test.mode, feeder.Sample())
+		}
+		for i, want := range test.want {
+			row, err := feeder.Next()
+			if want < 0 {
+				if !errors.Is(err, ErrSourceExhausted) {
+					t.Errorf("%s: Next() %d: got %v, want ErrSourceExhausted", test.mode, i, err)
+				}
+				continue
+			}
+			if err != nil || row["id"] != want {
+				t.Errorf("%s: Next() %d = %v, %v, want id %d", test.mode, i, row, err, want)
+			}
+		}
+	}
+
+	feeder, err := LoadFeeder(writeTemp(t, "rows.csv", "id\n0\n1\n2\n"), FeedRandom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[any]int{}
+	for i := 0; i < 300; i++ {
+		row, err := feeder.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[row["id"]]++
+	}
+	if len(seen) != 3 {
+		t.Errorf("random feeder drew %v, want every row", seen)
+	}
+}
@@ -0,0 +1,30 @@
+package loadtest
+
+import "io"
+
+// LoadGenerator drives traffic against a target and reports the outcome of a
+// single test step. Runner only talks to this interface, so engines other than
+// apib (or fakes in tests) can be swapped in.
+type LoadGenerator interface {
+	// Warmup issues a single request to make sure the target is reachable.
+	Warmup() error
+	// Run generates load with the given concurrency for duration seconds.
+	Run(concurrency, duration int) (*TestResult, error)
+}
+
+// RateGenerator is implemented by engines that can run open-loop tests, where
+// requests are issued on a fixed schedule regardless of how long responses
+// take.
+type RateGenerator interface {
+	LoadGenerator
+	// RunRate issues rate requests per second for duration seconds.
+	RunRate(rate float64, duration int) (*TestResult, error)
+}
+
+// ConnectionDrainer is implemented by generators that need the connections
+// left by one step to drain before the next step starts.
+type ConnectionDrainer interface {
+	// DrainConnections blocks until connections have drained, reporting
+	// progress to w.
+	DrainConnections(w io.Writer) error
+}
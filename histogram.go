@@ -0,0 +1,160 @@
+package loadtest
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// histogramSubBucketBits sets the precision of Histogram: 2^11 linear
+// sub-buckets per power of two keeps the relative error of any recorded value
+// below 0.1%.
+const histogramSubBucketBits = 11
+
+// Histogram is an HDR-style log-linear histogram of latencies. Values are
+// stored in microseconds with bounded relative error, so arbitrary percentiles
+// can be read back after a test without keeping every sample. Only non-empty
+// buckets are kept, which keeps the JSON encoding small.
+type Histogram struct {
+	Counts map[int]int64 `json:"counts"`
+	Total  int64         `json:"total"`
+	Sum    int64         `json:"sum_us"`
+	Min    int64         `json:"min_us"`
+	Max    int64         `json:"max_us"`
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{Counts: map[int]int64{}}
+}
+
+// Record adds a latency given in milliseconds
+func (h *Histogram) Record(latency float64) {
+	h.RecordN(latency, 1)
+}
+
+// RecordN adds count occurrences of a latency given in milliseconds
+func (h *Histogram) RecordN(latency float64, count int64) {
+	if count <= 0 {
+		return
+	}
+	us := int64(math.Round(latency * 1000))
+	if us < 0 {
+		us = 0
+	}
+	if h.Total == 0 || us < h.Min {
+		h.Min = us
+	}
+	if us > h.Max {
+		h.Max = us
+	}
+	h.Counts[histogramIndex(us)] += count
+	h.Total += count
+	h.Sum += us * count
+}
+
+// Merge adds every value recorded in other to h
+func (h *Histogram) Merge(other *Histogram) {
+	if other == nil || other.Total == 0 {
+		return
+	}
+	if h.Total == 0 || other.Min < h.Min {
+		h.Min = other.Min
+	}
+	if other.Max > h.Max {
+		h.Max = other.Max
+	}
+	for index, count := range other.Counts {
+		h.Counts[index] += count
+	}
+	h.Total += other.Total
+	h.Sum += other.Sum
+}
+
+// CorrectedCopy returns a copy of h corrected for coordinated omission: every
+// value larger than interval (ms) is back-filled with the values that requests
+// sent every interval would have observed while the sender was stalled.
+func (h *Histogram) CorrectedCopy(interval float64) *Histogram {
+	corrected := NewHistogram()
+	corrected.Merge(h)
+	if interval <= 0 {
+		return corrected
+	}
+	for index, count := range h.Counts {
+		latency := float64(histogramValue(index)) / 1000
+		for missing := latency - interval; missing >= interval; missing -= interval {
+			corrected.RecordN(missing, count)
+		}
+	}
+	return corrected
+}
+
+// Percentile returns the latency in milliseconds at percentile (0-100)
+func (h *Histogram) Percentile(percentile float64) float64 {
+	if h.Total == 0 {
+		return 0
+	}
+	if percentile <= 0 {
+		return float64(h.Min) / 1000
+	}
+	if percentile >= 100 {
+		return float64(h.Max) / 1000
+	}
+
+	rank := int64(math.Ceil(percentile / 100 * float64(h.Total)))
+	seen := int64(0)
+	for _, index := range h.indexes() {
+		seen += h.Counts[index]
+		if seen >= rank {
+			us := histogramValue(index)
+			us = max(min(us, h.Max), h.Min)
+			return float64(us) / 1000
+		}
+	}
+	return float64(h.Max) / 1000
+}
+
+// Mean returns the mean latency in milliseconds
+func (h *Histogram) Mean() float64 {
+	if h.Total == 0 {
+		return 0
+	}
+	return float64(h.Sum) / float64(h.Total) / 1000
+}
+
+// indexes returns the non-empty bucket indexes in ascending order
+func (h *Histogram) indexes() []int {
+	indexes := make([]int, 0, len(h.Counts))
+	for index, count := range h.Counts {
+		if count > 0 {
+			indexes = append(indexes, index)
+		}
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// histogramIndex maps a value to its bucket. Values below
+// 2^histogramSubBucketBits are stored exactly, larger values are truncated to
+// their histogramSubBucketBits most significant bits.
+func histogramIndex(us int64) int {
+	subBuckets := int64(1) << histogramSubBucketBits
+	if us < subBuckets {
+		return int(us)
+	}
+	shift := bits.Len64(uint64(us)) - histogramSubBucketBits
+	sub := us >> shift
+	half := subBuckets / 2
+	return int(int64(shift+1)*half + sub - half)
+}
+
+// histogramValue returns the midpoint of the values stored in a bucket
+func histogramValue(index int) int64 {
+	subBuckets := int64(1) << histogramSubBucketBits
+	if int64(index) < subBuckets {
+		return int64(index)
+	}
+	half := subBuckets / 2
+	shift := int64(index)/half - 1
+	sub := int64(index)%half + half
+	return sub<<shift + (int64(1)<<shift)/2
+}
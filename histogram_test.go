@@ -0,0 +1,104 @@
+package loadtest
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHistogramIndexRoundTrip(t *testing.T) {
+	for _, us := range []int64{0, 1, 1023, 2047, 2048, 2049, 4095, 4096, 4097, 1_000_000, 60_000_000} {
+		index := histogramIndex(us)
+		value := histogramValue(index)
+		if got := histogramIndex(value); got != index {
+			t.Errorf("%dµs: bucket %d holds %dµs, which maps to bucket %d", us, index, value, got)
+		}
+		if us < 2048 && value != us {
+			t.Errorf("%dµs: got %dµs, want it exactly", us, value)
+		}
+		if err := math.Abs(float64(value-us)) / float64(max(us, 1)); err > 0.001 {
+			t.Errorf("%dµs: got %dµs, relative error %.4f", us, value, err)
+		}
+	}
+
+	// Neighbors across a power of two must not share a bucket
+	for _, pair := range [][2]int64{{2047, 2048}, {4095, 4096}} {
+		if histogramIndex(pair[0]) == histogramIndex(pair[1]) {
+			t.Errorf("%dµs and %dµs share bucket %d", pair[0], pair[1], histogramIndex(pair[0]))
+		}
+	}
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	h := NewHistogram()
+	for _, latency := range []float64{2.047, 2.048, 4.095, 4.096} {
+		h.Record(latency)
+	}
+	for _, test := range []struct {
+		percentile float64
+		want       float64
+	}{
+		{0, 2.047},
+		{25, 2.047},
+		// 2.048ms is in a two-value bucket read back as its midpoint
+		{50, 2.049},
+		{75, 4.095},
+		{100, 4.096},
+	} {
+		if got := h.Percentile(test.percentile); got != test.want {
+			t.Errorf("Percentile(%g) = %g, want %g", test.percentile, got, test.want)
+		}
+	}
+	if got, want := h.Mean(), (2.047+2.048+4.095+4.096)/4; math.Abs(got-want) > 1e-9 {
+		t.Errorf("Mean() = %g, want %g", got, want)
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	a, b := NewHistogram(), NewHistogram()
+	a.Record(5)
+	a.Record(10)
+	b.RecordN(1, 3)
+	b.Record(20)
+
+	merged := NewHistogram()
+	merged.Merge(a)
+	merged.Merge(b)
+	merged.Merge(nil)
+	merged.Merge(NewHistogram())
+	if merged.Total != 6 || merged.Sum != 38_000 || merged.Min != 1000 || merged.Max != 20_000 {
+		t.Errorf("merged total %d, sum %dµs, min %dµs, max %dµs; want 6, 38000, 1000, 20000", merged.Total, merged.Sum, merged.Min, merged.Max)
+	}
+	if got := merged.Counts[histogramIndex(1000)]; got != 3 {
+		t.Errorf("merged count at 1ms = %d, want 3", got)
+	}
+	if a.Total != 2 || b.Total != 4 {
+		t.Errorf("merging changed its inputs: totals %d and %d", a.Total, b.Total)
+	}
+}
+
+func TestHistogramCorrectedCopy(t *testing.T) {
+	h := NewHistogram()
+	h.RecordN(1, 9)
+	h.Record(10)
+
+	// The 10ms stall, stored in a bucket read back as 10.004ms, hid requests
+	// that would have waited 8.004, 6.004, 4.004 and 2.004ms
+	corrected := h.CorrectedCopy(2)
+	if corrected.Total != 14 {
+		t.Errorf("corrected total = %d, want 14", corrected.Total)
+	}
+	for _, latency := range []float64{2, 4, 6, 8} {
+		if got := corrected.Counts[histogramIndex(int64(latency*1000)+4)]; got != 1 {
+			t.Errorf("corrected count near %gms = %d, want 1", latency, got)
+		}
+	}
+	if got := corrected.Counts[histogramIndex(1000)]; got != 9 {
+		t.Errorf("corrected count at 1ms = %d, want 9", got)
+	}
+	if h.Total != 10 {
+		t.Errorf("CorrectedCopy changed the original: total %d", h.Total)
+	}
+	if uncorrected := h.CorrectedCopy(0); uncorrected.Total != h.Total {
+		t.Errorf("CorrectedCopy(0) total = %d, want %d", uncorrected.Total, h.Total)
+	}
+}
@@ -0,0 +1,56 @@
+package loadtest
+
+import (
+	"fmt"
+)
+
+// ImpliedConcurrency returns the mean number of requests in flight during the
+// test by Little's law, L = λW: throughput times average latency. The raw
+// latency is used for corrected results, since requests are only in flight
+// from when they were actually sent.
+func (r *TestResult) ImpliedConcurrency() float64 {
+	latency := r.AvgLatency
+	if r.Corrected {
+		latency = r.RawAvgLatency
+	}
+	return r.Throughput * latency / 1000
+}
+
+// littlesLawWarning checks the result against Little's law and describes the
+// problem when the implied concurrency is off by more than tolerance, or
+// returns "" if it is consistent.
+//
+// In a closed-loop test every connection should always have a request in
+// flight. Fewer implied requests mean connections sat idle: either fewer were
+// opened than configured, or the load generator was too slow to issue the
+// next request, making it the bottleneck rather than the server. More implied
+// requests than connections means latency or throughput was mismeasured. In
+// an open-loop test the generator is the bottleneck when throughput falls
+// short of the target rate.
+func (r *TestResult) littlesLawWarning(tolerance float64) string {
+	if r.Throughput <= 0 {
+		return ""
+	}
+	implied := r.ImpliedConcurrency()
+
+	if r.TargetRate > 0 {
+		if r.Throughput < (1-tolerance)*r.TargetRate {
+			return fmt.Sprintf("throughput %.2f RPS fell short of the target rate %.2f RPS, the load generator or server could not keep up (%.2f requests in flight on average)", r.Throughput, r.TargetRate, implied)
+		}
+		return ""
+	}
+
+	if r.Connections <= 0 {
+		return ""
+	}
+	ratio := implied / float64(r.Connections)
+	switch {
+	case ratio < 1-tolerance && r.Sockets > 0 && r.Sockets < r.Connections:
+		return fmt.Sprintf("Little's law implies %.2f requests in flight for %d connections, connections were idle (only %d opened)", implied, r.Connections, r.Sockets)
+	case ratio < 1-tolerance:
+		return fmt.Sprintf("Little's law implies %.2f requests in flight for %d connections, the load generator was the bottleneck (%.0f%% of the time spent between requests)", implied, r.Connections, (1-ratio)*100)
+	case ratio > 1+tolerance:
+		return fmt.Sprintf("Little's law implies %.2f requests in flight for %d connections, latency or throughput may be mismeasured", implied, r.Connections)
+	}
+	return ""
+}
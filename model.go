@@ -0,0 +1,564 @@
+package loadtest
+
+import (
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+type ModelType string
+
+const (
+	// ModelQuadratic fits latency as ax² + bx + c
+	ModelQuadratic ModelType = "quadratic"
+	// ModelLinear fits latency as bx + c
+	ModelLinear ModelType = "linear"
+	// ModelExponential fits latency as a·e^(bx)
+	ModelExponential ModelType = "exponential"
+	// ModelPower fits latency as a·x^b
+	ModelPower ModelType = "power"
+	// ModelPiecewise fits two connected line segments with a fitted breakpoint
+	ModelPiecewise ModelType = "piecewise"
+	// ModelUSL fits the Universal Scalability Law to throughput vs.
+	// concurrency and derives latency from it, see USLModel
+	ModelUSL ModelType = "usl"
+)
+
+// ModelTypes lists every supported model
+var ModelTypes = []ModelType{ModelQuadratic, ModelLinear, ModelExponential, ModelPower, ModelPiecewise, ModelUSL}
+
+// Observation is a single test result as seen by a Model
+type Observation struct {
+	// Load is the concurrency, or target rate for open-loop tests
+	Load float64
+	// Latency is the latency (ms) at the percentile being predicted on
+	Latency    float64
+	AvgLatency float64
+	Throughput float64
+	// Weight is the relative weight of the observation in the fit, where 0
+	// counts as 1
+	Weight float64
+}
+
+// Model is a regression of latency vs. load used to predict the load at
+// which a target latency is reached.
+type Model interface {
+	Name() ModelType
+	Fit(observations []Observation) error
+	// Predict returns the fitted latency (ms) at load x
+	Predict(x float64) float64
+	// Solve returns the load at which the fitted latency reaches latency
+	Solve(latency float64) (float64, error)
+	// Describe returns the fitted equation
+	Describe() string
+	// NumParams returns the number of fitted parameters
+	NumParams() int
+	// Coefficients returns the fitted parameters, in the order they appear
+	// in Describe
+	Coefficients() []Coefficient
+}
+
+// Coefficient is a named fitted parameter of a Model
+type Coefficient struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+}
+
+// ConditionedModel is implemented by models fitted by linear least squares,
+// which report the condition number of their (scaled) design matrix. Large
+// values mean the fitted coefficients are sensitive to noise in the data.
+type ConditionedModel interface {
+	Model
+	ConditionNumber() float64
+}
+
+// ThroughputModel is implemented by models that also describe throughput
+type ThroughputModel interface {
+	Model
+	Throughput(x float64) float64
+}
+
+func NewModel(modelType ModelType) (Model, error) {
+	switch modelType {
+	case ModelQuadratic:
+		return &QuadraticModel{}, nil
+	case ModelLinear:
+		return &LinearModel{}, nil
+	case ModelExponential:
+		return &ExponentialModel{}, nil
+	case ModelPower:
+		return &PowerModel{}, nil
+	case ModelPiecewise:
+		return &PiecewiseLinearModel{}, nil
+	case ModelUSL:
+		return &USLModel{}, nil
+	default:
+		return nil, fmt.Errorf("unknown model %q", modelType)
+	}
+}
+
+// fitModel creates a model of modelType and fits it to the results, see
+// observationsFor for the weighting.
+func fitModel(modelType ModelType, results []*TestResult, latencyPercentile LatencyPercentile, targetLatency int, bandwidth float64) (Model, error) {
+	if modelType == ModelUSL && len(results) > 0 && results[0].TargetRate > 0 {
+		return nil, fmt.Errorf("the USL model requires fixed concurrency tests")
+	}
+	model, err := NewModel(modelType)
+	if err != nil {
+		return nil, err
+	}
+	observations, err := observationsFor(results, latencyPercentile, targetLatency, bandwidth)
+	if err != nil {
+		return nil, err
+	}
+	if err := model.Fit(observations); err != nil {
+		return nil, fmt.Errorf("failed to fit %s model: %w", modelType, err)
+	}
+	return model, nil
+}
+
+// observationsFor converts results to observations. With a positive
+// bandwidth, observations are weighted by their latency's distance from
+// targetLatency on a log scale, so the fit is most accurate near the target:
+//
+//	weight = 1 / (1 + (ln(latency/target) / bandwidth)²)
+func observationsFor(results []*TestResult, latencyPercentile LatencyPercentile, targetLatency int, bandwidth float64) ([]Observation, error) {
+	observations := make([]Observation, len(results))
+	for i, res := range results {
+		latency := res.Latency(latencyPercentile)
+		if latency < 0 {
+			return nil, fmt.Errorf("latency percentile %q is not available for %s %g", latencyPercentile, res.LoadName(), res.Load())
+		}
+		weight := 1.0
+		if bandwidth > 0 && latency > 0 && targetLatency > 0 {
+			distance := math.Log(latency/float64(targetLatency)) / bandwidth
+			weight = 1 / (1 + distance*distance)
+		}
+		observations[i] = Observation{
+			Load:       res.Load(),
+			Latency:    latency,
+			AvgLatency: res.AvgLatency,
+			Throughput: res.Throughput,
+			Weight:     weight,
+		}
+	}
+	return observations, nil
+}
+
+// polynomialFit fits y = β₀ + β₁x + ... + β_degree·x^degree by weighted least
+// squares. The fit is done on x centered and scaled to [-1, 1], which keeps
+// the design well-conditioned for large loads, and the coefficients are
+// converted back. It also returns the condition number of the scaled design.
+func polynomialFit(xs, ys, weights []float64, degree int) ([]float64, float64, error) {
+	n := len(xs)
+	if n < degree+1 {
+		return nil, 0, fmt.Errorf("insufficient data points for degree %d regression (need at least %d)", degree, degree+1)
+	}
+
+	// Center and scale x to z = (x - center) / scale
+	center := 0.0
+	for _, x := range xs {
+		center += x
+	}
+	center /= float64(n)
+	scale := 0.0
+	for _, x := range xs {
+		scale = math.Max(scale, math.Abs(x-center))
+	}
+	if scale == 0 {
+		return nil, 0, fmt.Errorf("all data points have the same load")
+	}
+
+	// Create the design matrix, each row: [1, z, z^2, ...]
+	X := mat.NewDense(n, degree+1, nil)
+	for i, x := range xs {
+		z := (x - center) / scale
+		for j := 0; j <= degree; j++ {
+			X.Set(i, j, math.Pow(z, float64(j)))
+		}
+	}
+	gamma, cond, err := leastSquares(X, ys, weights)
+	if err != nil {
+		return nil, cond, err
+	}
+
+	// Expand Σ γⱼ((x - center)/scale)^j into powers of x
+	beta := make([]float64, degree+1)
+	for j, g := range gamma {
+		for k := 0; k <= j; k++ {
+			beta[k] += g * binomial(j, k) * math.Pow(-center, float64(j-k)) / math.Pow(scale, float64(j))
+		}
+	}
+	return beta, cond, nil
+}
+
+func binomial(n, k int) float64 {
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result = result * float64(n-k+i) / float64(i)
+	}
+	return result
+}
+
+// leastSquares solves X·β = y for β in the weighted least squares sense
+// using a QR decomposition, after scaling every column of X to unit norm. A
+// nil weights counts every row equally. It also returns the condition number
+// of the scaled design matrix.
+func leastSquares(X *mat.Dense, ys, weights []float64) ([]float64, float64, error) {
+	n, p := X.Dims()
+	if n < p {
+		return nil, 0, fmt.Errorf("insufficient data points for %d coefficients", p)
+	}
+
+	// Weight the rows by √w
+	A := mat.NewDense(n, p, nil)
+	y := mat.NewVecDense(n, nil)
+	for i := 0; i < n; i++ {
+		w := 1.0
+		if weights != nil {
+			w = math.Sqrt(weightOf(weights[i]))
+		}
+		for j := 0; j < p; j++ {
+			A.Set(i, j, w*X.At(i, j))
+		}
+		y.SetVec(i, w*ys[i])
+	}
+
+	// Scale columns to unit norm
+	norms := make([]float64, p)
+	for j := 0; j < p; j++ {
+		norms[j] = mat.Norm(A.ColView(j), 2)
+		if norms[j] == 0 {
+			return nil, 0, fmt.Errorf("design matrix column %d is all zeros", j)
+		}
+		for i := 0; i < n; i++ {
+			A.Set(i, j, A.At(i, j)/norms[j])
+		}
+	}
+
+	var qr mat.QR
+	qr.Factorize(A)
+	cond := qr.Cond()
+	if math.IsInf(cond, 1) || cond > 1e14 {
+		return nil, cond, fmt.Errorf("design matrix is rank deficient (condition number %.3g)", cond)
+	}
+
+	var beta mat.Dense
+	if err := qr.SolveTo(&beta, false, y); err != nil {
+		return nil, cond, fmt.Errorf("failed to solve least squares: %w", err)
+	}
+	coefficients := make([]float64, p)
+	for j := range coefficients {
+		coefficients[j] = beta.At(j, 0) / norms[j]
+	}
+	return coefficients, cond, nil
+}
+
+// weightOf returns the weight of an observation, counting 0 as 1
+func weightOf(weight float64) float64 {
+	if weight <= 0 {
+		return 1
+	}
+	return weight
+}
+
+func splitObservations(observations []Observation) ([]float64, []float64, []float64) {
+	xs := make([]float64, len(observations))
+	ys := make([]float64, len(observations))
+	ws := make([]float64, len(observations))
+	for i, o := range observations {
+		xs[i] = o.Load
+		ys[i] = o.Latency
+		ws[i] = o.Weight
+	}
+	return xs, ys, ws
+}
+
+// QuadraticModel fits latency = Ax² + Bx + C
+type QuadraticModel struct {
+	A, B, C   float64
+	Condition float64
+}
+
+func (m *QuadraticModel) Name() ModelType { return ModelQuadratic }
+
+func (m *QuadraticModel) NumParams() int { return 3 }
+
+func (m *QuadraticModel) Coefficients() []Coefficient {
+	return []Coefficient{{"a", m.A}, {"b", m.B}, {"c", m.C}}
+}
+
+func (m *QuadraticModel) ConditionNumber() float64 { return m.Condition }
+
+func (m *QuadraticModel) Fit(observations []Observation) error {
+	xs, ys, ws := splitObservations(observations)
+	beta, cond, err := polynomialFit(xs, ys, ws, 2)
+	if err != nil {
+		return err
+	}
+	m.C, m.B, m.A = beta[0], beta[1], beta[2]
+	m.Condition = cond
+	return nil
+}
+
+func (m *QuadraticModel) Predict(x float64) float64 {
+	return m.A*x*x + m.B*x + m.C
+}
+
+func (m *QuadraticModel) Solve(latency float64) (float64, error) {
+	// Solve ax^2 + bx + c = latency for x
+	// x = (-b ± sqrt(b^2 - 4ac)) / 2a
+	if m.A == 0 {
+		return (&LinearModel{B: m.B, C: m.C}).Solve(latency)
+	}
+	delta := m.B*m.B - 4*m.A*(m.C-latency)
+	if delta < 0 {
+		return 0, fmt.Errorf("no real solutions for load at target latency %.2fms", latency)
+	}
+
+	// Return the positive root (the other root is typically negative and irrelevant)
+	return (-m.B + math.Sqrt(delta)) / (2 * m.A), nil
+}
+
+func (m *QuadraticModel) Describe() string {
+	return fmt.Sprintf("Quadratic regression equation: Latency (ms) = %.4gx^2 + %.4gx + %.4g", m.A, m.B, m.C)
+}
+
+// LinearModel fits latency = Bx + C
+type LinearModel struct {
+	B, C      float64
+	Condition float64
+}
+
+func (m *LinearModel) Name() ModelType { return ModelLinear }
+
+func (m *LinearModel) NumParams() int { return 2 }
+
+func (m *LinearModel) Coefficients() []Coefficient {
+	return []Coefficient{{"b", m.B}, {"c", m.C}}
+}
+
+func (m *LinearModel) ConditionNumber() float64 { return m.Condition }
+
+func (m *LinearModel) Fit(observations []Observation) error {
+	xs, ys, ws := splitObservations(observations)
+	beta, cond, err := polynomialFit(xs, ys, ws, 1)
+	if err != nil {
+		return err
+	}
+	m.C, m.B = beta[0], beta[1]
+	m.Condition = cond
+	return nil
+}
+
+func (m *LinearModel) Predict(x float64) float64 {
+	return m.B*x + m.C
+}
+
+func (m *LinearModel) Solve(latency float64) (float64, error) {
+	if m.B == 0 {
+		return 0, fmt.Errorf("latency does not change with load, target latency %.2fms cannot be solved for", latency)
+	}
+	return (latency - m.C) / m.B, nil
+}
+
+func (m *LinearModel) Describe() string {
+	return fmt.Sprintf("Linear regression equation: Latency (ms) = %.4gx + %.4g", m.B, m.C)
+}
+
+// ExponentialModel fits latency = A·e^(Bx), linearized as ln(latency) = ln(A) + Bx
+type ExponentialModel struct {
+	A, B      float64
+	Condition float64
+}
+
+func (m *ExponentialModel) Name() ModelType { return ModelExponential }
+
+func (m *ExponentialModel) NumParams() int { return 2 }
+
+func (m *ExponentialModel) Coefficients() []Coefficient {
+	return []Coefficient{{"a", m.A}, {"b", m.B}}
+}
+
+func (m *ExponentialModel) ConditionNumber() float64 { return m.Condition }
+
+func (m *ExponentialModel) Fit(observations []Observation) error {
+	xs, ys, ws := splitObservations(observations)
+	for i, y := range ys {
+		if y <= 0 {
+			return fmt.Errorf("exponential fit requires positive latencies")
+		}
+		ys[i] = math.Log(y)
+	}
+	beta, cond, err := polynomialFit(xs, ys, ws, 1)
+	if err != nil {
+		return err
+	}
+	m.A, m.B = math.Exp(beta[0]), beta[1]
+	m.Condition = cond
+	return nil
+}
+
+func (m *ExponentialModel) Predict(x float64) float64 {
+	return m.A * math.Exp(m.B*x)
+}
+
+func (m *ExponentialModel) Solve(latency float64) (float64, error) {
+	if m.B == 0 || latency <= 0 {
+		return 0, fmt.Errorf("no solution for load at target latency %.2fms", latency)
+	}
+	return math.Log(latency/m.A) / m.B, nil
+}
+
+func (m *ExponentialModel) Describe() string {
+	return fmt.Sprintf("Exponential regression equation: Latency (ms) = %.4g * e^(%.4gx)", m.A, m.B)
+}
+
+// PowerModel fits latency = A·x^B, linearized as ln(latency) = ln(A) + B·ln(x)
+type PowerModel struct {
+	A, B      float64
+	Condition float64
+}
+
+func (m *PowerModel) Name() ModelType { return ModelPower }
+
+func (m *PowerModel) NumParams() int { return 2 }
+
+func (m *PowerModel) Coefficients() []Coefficient {
+	return []Coefficient{{"a", m.A}, {"b", m.B}}
+}
+
+func (m *PowerModel) ConditionNumber() float64 { return m.Condition }
+
+func (m *PowerModel) Fit(observations []Observation) error {
+	xs, ys, ws := splitObservations(observations)
+	for i := range xs {
+		if xs[i] <= 0 || ys[i] <= 0 {
+			return fmt.Errorf("power-law fit requires positive load and latency")
+		}
+		xs[i] = math.Log(xs[i])
+		ys[i] = math.Log(ys[i])
+	}
+	beta, cond, err := polynomialFit(xs, ys, ws, 1)
+	if err != nil {
+		return err
+	}
+	m.A, m.B = math.Exp(beta[0]), beta[1]
+	m.Condition = cond
+	return nil
+}
+
+func (m *PowerModel) Predict(x float64) float64 {
+	return m.A * math.Pow(x, m.B)
+}
+
+func (m *PowerModel) Solve(latency float64) (float64, error) {
+	if m.B == 0 || latency <= 0 {
+		return 0, fmt.Errorf("no solution for load at target latency %.2fms", latency)
+	}
+	return math.Pow(latency/m.A, 1/m.B), nil
+}
+
+func (m *PowerModel) Describe() string {
+	return fmt.Sprintf("Power-law regression equation: Latency (ms) = %.4g * x^%.4g", m.A, m.B)
+}
+
+// PiecewiseLinearModel fits two line segments joined at Breakpoint:
+//
+//	latency = C + Bx + D·max(0, x - Breakpoint)
+//
+// The breakpoint is chosen among the observed loads to minimize the squared
+// error, which captures a flat region followed by a sharp rise.
+type PiecewiseLinearModel struct {
+	B, C, D    float64
+	Breakpoint float64
+	Condition  float64
+}
+
+func (m *PiecewiseLinearModel) Name() ModelType { return ModelPiecewise }
+
+func (m *PiecewiseLinearModel) NumParams() int { return 4 }
+
+func (m *PiecewiseLinearModel) Coefficients() []Coefficient {
+	return []Coefficient{{"b", m.B}, {"c", m.C}, {"d", m.D}, {"breakpoint", m.Breakpoint}}
+}
+
+func (m *PiecewiseLinearModel) ConditionNumber() float64 { return m.Condition }
+
+func (m *PiecewiseLinearModel) Fit(observations []Observation) error {
+	xs, ys, ws := splitObservations(observations)
+	if len(xs) < 4 {
+		return fmt.Errorf("insufficient data points for piecewise regression (need at least 4)")
+	}
+
+	best := math.Inf(1)
+	for _, k := range xs {
+		// Both segments need at least two points
+		below := 0
+		for _, x := range xs {
+			if x <= k {
+				below++
+			}
+		}
+		if below < 2 || len(xs)-below < 2 {
+			continue
+		}
+
+		X := mat.NewDense(len(xs), 3, nil)
+		for i, x := range xs {
+			X.Set(i, 0, 1)
+			X.Set(i, 1, x)
+			X.Set(i, 2, math.Max(0, x-k))
+		}
+		beta, cond, err := leastSquares(X, ys, ws)
+		if err != nil {
+			continue
+		}
+
+		candidate := PiecewiseLinearModel{C: beta[0], B: beta[1], D: beta[2], Breakpoint: k, Condition: cond}
+		sse := 0.0
+		for i, x := range xs {
+			residual := ys[i] - candidate.Predict(x)
+			sse += weightOf(ws[i]) * residual * residual
+		}
+		if sse < best {
+			best = sse
+			*m = candidate
+		}
+	}
+
+	if math.IsInf(best, 1) {
+		return fmt.Errorf("no valid breakpoint found")
+	}
+	return nil
+}
+
+func (m *PiecewiseLinearModel) Predict(x float64) float64 {
+	return m.C + m.B*x + m.D*math.Max(0, x-m.Breakpoint)
+}
+
+func (m *PiecewiseLinearModel) Solve(latency float64) (float64, error) {
+	// First segment
+	if m.B != 0 {
+		x := (latency - m.C) / m.B
+		if x <= m.Breakpoint && (m.B > 0 || x >= 0) {
+			return x, nil
+		}
+	}
+
+	// Second segment
+	slope := m.B + m.D
+	if slope == 0 {
+		return 0, fmt.Errorf("no solution for load at target latency %.2fms", latency)
+	}
+	x := m.Breakpoint + (latency-m.Predict(m.Breakpoint))/slope
+	if x < m.Breakpoint {
+		return 0, fmt.Errorf("no solution for load at target latency %.2fms", latency)
+	}
+	return x, nil
+}
+
+func (m *PiecewiseLinearModel) Describe() string {
+	return fmt.Sprintf("Piecewise linear regression equation: Latency (ms) = %.4gx + %.4g, with slope %.4g above x = %.4g", m.B, m.C, m.B+m.D, m.Breakpoint)
+}
@@ -0,0 +1,349 @@
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NativeGenerator is an in-process load generator built on net/http, so no
+// external binary is required. Run is closed-loop: each of the concurrency
+// workers issues requests back-to-back for the duration of the step. RunRate
+// is open-loop: requests are started on a fixed schedule regardless of how
+// long earlier requests take.
+//
+// Both modes report latencies corrected for coordinated omission alongside
+// the raw ones. In open-loop mode each latency is measured from the request's
+// scheduled send time. In closed-loop mode the intended send times are not
+// known up front, so every sample longer than the step's median latency is
+// back-filled with the samples that requests sent at that interval would have
+// observed while the worker was stalled. The back-filled samples are shorter
+// than the stall they came from and can lower the upper percentiles, so the
+// corrected latencies are clamped to at least the raw ones, see
+// TestResult.SetHistograms.
+//
+// Requests come from a RequestSource: a single *Request, or a Corpus to replay
+// mixed traffic.
+type NativeGenerator struct {
+	Source RequestSource
+	// WarmupTimeout bounds the warmup request, so an unreachable target fails
+	// the run instead of hanging it
+	WarmupTimeout time.Duration
+}
+
+func NewNativeGenerator(source RequestSource) *NativeGenerator {
+	return &NativeGenerator{Source: source, WarmupTimeout: 30 * time.Second}
+}
+
+func (g *NativeGenerator) Warmup() error {
+	var request *Request
+	var err error
+	if source, ok := g.Source.(WarmupSource); ok {
+		request, err = source.WarmupRequest()
+	} else {
+		request, err = g.Source.NewUser(0).Next()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get warmup request: %w", err)
+	}
+	req, err := request.httpRequest()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if g.WarmupTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.WarmupTimeout)
+		defer cancel()
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("warmup request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return fmt.Errorf("failed to read warmup response: %w", err)
+	}
+	return nil
+}
+
+func (g *NativeGenerator) Run(concurrency, duration int) (*TestResult, error) {
+	if concurrency < 1 {
+		return nil, fmt.Errorf("concurrency must be at least 1, got %d", concurrency)
+	}
+
+	rec := newNativeRecorder(false)
+	client, transport := rec.newClient(concurrency)
+	defer transport.CloseIdleConnections()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(duration)*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var sourceErr error
+	var sourceErrOnce sync.Once
+	start := time.Now()
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(user RequestIterator) {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				request, err := user.Next()
+				if err != nil {
+					// Stop the whole step, the source can't supply more requests
+					sourceErrOnce.Do(func() { sourceErr = err })
+					cancel()
+					return
+				}
+				_, latency, status, err := g.do(ctx, client, request)
+				// Requests cut off by the end of the step are not failures
+				if err != nil && ctx.Err() != nil {
+					return
+				}
+				rec.record(request.Label, latency, 0, status, err)
+			}
+		}(g.Source.NewUser(i))
+	}
+	wg.Wait()
+	// A source that ran out ends the step early with what was recorded
+	if sourceErr != nil && (!errors.Is(sourceErr, ErrSourceExhausted) || rec.empty()) {
+		return nil, fmt.Errorf("failed to get next request: %w", sourceErr)
+	}
+
+	return rec.result(time.Since(start), 0, concurrency, 0), nil
+}
+
+func (g *NativeGenerator) RunRate(rate float64, duration int) (*TestResult, error) {
+	if rate <= 0 {
+		return nil, fmt.Errorf("rate must be positive, got %g", rate)
+	}
+	interval := time.Duration(float64(time.Second) / rate)
+	if interval <= 0 {
+		return nil, fmt.Errorf("rate %g is too high to schedule, the interval between requests must be at least 1ns", rate)
+	}
+
+	rec := newNativeRecorder(true)
+	client, transport := rec.newClient(0)
+	defer transport.CloseIdleConnections()
+
+	// Requests still outstanding once the schedule ends get another duration
+	// to complete before they are counted as errors.
+	length := time.Duration(duration) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), 2*length)
+	defer cancel()
+
+	// The scheduler is the only virtual user in open-loop mode
+	user := g.Source.NewUser(0)
+	var wg sync.WaitGroup
+	var inFlight, peak int64
+	start := time.Now()
+	end := start.Add(length)
+	for i := 0; ; i++ {
+		intended := start.Add(time.Duration(i) * interval)
+		if !intended.Before(end) {
+			break
+		}
+		time.Sleep(time.Until(intended))
+		request, err := user.Next()
+		if errors.Is(err, ErrSourceExhausted) && i > 0 {
+			// End the schedule early with the requests already sent
+			end = intended
+			break
+		}
+		if err != nil {
+			cancel()
+			wg.Wait()
+			return nil, fmt.Errorf("failed to get next request: %w", err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n := atomic.AddInt64(&inFlight, 1)
+			defer atomic.AddInt64(&inFlight, -1)
+			for {
+				p := atomic.LoadInt64(&peak)
+				if n <= p || atomic.CompareAndSwapInt64(&peak, p, n) {
+					break
+				}
+			}
+			sent, latency, status, err := g.do(ctx, client, request)
+			rec.record(request.Label, latency, sent.Sub(intended), status, err)
+		}()
+	}
+	wg.Wait()
+
+	// Throughput is measured over the schedule, as draining the requests
+	// outstanding at its end would otherwise count as idle time
+	return rec.result(end.Sub(start), max(time.Since(end), 0), int(peak), rate), nil
+}
+
+// do sends a single request and returns when it was sent and how long it took
+func (g *NativeGenerator) do(ctx context.Context, client *http.Client, request *Request) (time.Time, time.Duration, int, error) {
+	sent := time.Now()
+	req, err := request.httpRequest()
+	if err != nil {
+		return sent, 0, 0, err
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return sent, time.Since(sent), 0, err
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return sent, time.Since(sent), resp.StatusCode, err
+}
+
+// nativeRecorder collects the outcome of every request in a step, bucketed
+// by request label.
+type nativeRecorder struct {
+	mu        sync.Mutex
+	openLoop  bool
+	endpoints map[string]*endpointRecorder
+	sockets   int64
+}
+
+type endpointRecorder struct {
+	raw        *Histogram
+	corrected  *Histogram
+	successful int
+	errors     int
+}
+
+func newNativeRecorder(openLoop bool) *nativeRecorder {
+	return &nativeRecorder{openLoop: openLoop, endpoints: map[string]*endpointRecorder{}}
+}
+
+// empty reports whether no request outcome has been recorded
+func (rec *nativeRecorder) empty() bool {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return len(rec.endpoints) == 0
+}
+
+// newClient returns a client limited to maxConns connections (0 for no limit)
+// that counts every new connection it opens.
+func (rec *nativeRecorder) newClient(maxConns int) (*http.Client, *http.Transport) {
+	idle := maxConns
+	if idle == 0 {
+		idle = 1024
+	}
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConns:        idle,
+		MaxIdleConnsPerHost: idle,
+		MaxConnsPerHost:     maxConns,
+	}
+	client := &http.Client{Transport: &tracingTransport{base: transport, rec: rec}}
+	return client, transport
+}
+
+// record adds a request outcome. delay is how late the request was sent
+// compared to its schedule and is only meaningful in open-loop mode.
+func (rec *nativeRecorder) record(label string, latency, delay time.Duration, status int, err error) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	endpoint, ok := rec.endpoints[label]
+	if !ok {
+		endpoint = &endpointRecorder{raw: NewHistogram(), corrected: NewHistogram()}
+		rec.endpoints[label] = endpoint
+	}
+
+	if err != nil {
+		endpoint.errors++
+		return
+	}
+	endpoint.raw.Record(float64(latency) / float64(time.Millisecond))
+	if rec.openLoop {
+		endpoint.corrected.Record(float64(latency+delay) / float64(time.Millisecond))
+	}
+	if status >= 200 && status < 300 {
+		endpoint.successful++
+	}
+}
+
+// result summarizes the step run over elapsed, followed by drain waiting for
+// outstanding requests. When requests had more than one label, a result
+// per label is included in Endpoints.
+func (rec *nativeRecorder) result(elapsed, drain time.Duration, connections int, targetRate float64) *TestResult {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	total := &endpointRecorder{raw: NewHistogram(), corrected: NewHistogram()}
+	for _, endpoint := range rec.endpoints {
+		total.raw.Merge(endpoint.raw)
+		total.corrected.Merge(endpoint.corrected)
+		total.successful += endpoint.successful
+		total.errors += endpoint.errors
+	}
+
+	// Closed-loop workers are expected to send a request every median
+	// latency, whichever endpoint they call
+	interval := total.raw.Percentile(50)
+	res := rec.endpointResult("native", total, elapsed, connections, targetRate, interval)
+	res.Sockets = int(atomic.LoadInt64(&rec.sockets))
+	res.Drain = drain.Seconds()
+	if len(rec.endpoints) < 2 {
+		return res
+	}
+
+	labels := make([]string, 0, len(rec.endpoints))
+	for label := range rec.endpoints {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		res.Endpoints = append(res.Endpoints, rec.endpointResult(label, rec.endpoints[label], elapsed, connections, targetRate, interval))
+	}
+	return res
+}
+
+func (rec *nativeRecorder) endpointResult(name string, endpoint *endpointRecorder, elapsed time.Duration, connections int, targetRate float64, interval float64) *TestResult {
+	res := &TestResult{
+		Name:        name,
+		Threads:     runtime.GOMAXPROCS(0),
+		Connections: connections,
+		TargetRate:  targetRate,
+		Duration:    elapsed.Seconds(),
+		Completed:   int(endpoint.raw.Total),
+		Successful:  endpoint.successful,
+		Errors:      endpoint.errors,
+	}
+	res.Throughput = float64(res.Completed) / res.Duration
+	if endpoint.raw.Total == 0 {
+		return res
+	}
+
+	corrected := endpoint.corrected
+	if !rec.openLoop {
+		corrected = endpoint.raw.CorrectedCopy(interval)
+	}
+	res.SetHistograms(corrected, endpoint.raw)
+	return res
+}
+
+// tracingTransport counts every connection that was not reused from the pool
+type tracingTransport struct {
+	base http.RoundTripper
+	rec  *nativeRecorder
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if !info.Reused {
+				atomic.AddInt64(&t.rec.sockets, 1)
+			}
+		},
+	}
+	return t.base.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
@@ -0,0 +1,216 @@
+package loadtest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// limitedSource hands out its request until limit requests have been drawn
+type limitedSource struct {
+	request *Request
+	limit   int64
+	drawn   atomic.Int64
+}
+
+func (s *limitedSource) NewUser(id int) RequestIterator { return s }
+
+func (s *limitedSource) Next() (*Request, error) {
+	if n := s.drawn.Add(1); n > s.limit {
+		return nil, fmt.Errorf("%w after %d requests", ErrSourceExhausted, s.limit)
+	}
+	return s.request, nil
+}
+
+// stall blocks until the client gives up on the request
+func stall(r *http.Request) {
+	select {
+	case <-r.Context().Done():
+	case <-time.After(10 * time.Second):
+	}
+}
+
+func TestNativeRunCounts(t *testing.T) {
+	// Every fifth request gets a malformed response and every fifth a 503
+	var served, malformed, unavailable atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond)
+		switch served.Add(1) % 5 {
+		case 0:
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			malformed.Add(1)
+			conn.Write([]byte("not http\r\n\r\n"))
+			conn.Close()
+		case 1:
+			unavailable.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	res, err := NewNativeGenerator(NewRequest(server.URL)).Run(4, 1)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.Connections != 4 || res.Completed == 0 || res.Errors == 0 {
+		t.Fatalf("got %d connections, %d completed and %d errors", res.Connections, res.Completed, res.Errors)
+	}
+	// Requests cut off by the end of the step are neither completed nor
+	// errors, so the client may see up to one fewer per connection
+	if missing := served.Load() - int64(res.Completed+res.Errors); missing < 0 || missing > 4 {
+		t.Errorf("server saw %d requests, client recorded %d", served.Load(), res.Completed+res.Errors)
+	}
+	if diff := malformed.Load() - int64(res.Errors); diff < 0 || diff > 4 {
+		t.Errorf("%d errors, want about %d malformed responses", res.Errors, malformed.Load())
+	}
+	if diff := unavailable.Load() - int64(res.Completed-res.Successful); diff < 0 || diff > 4 {
+		t.Errorf("%d non-2xx responses, want about %d", res.Completed-res.Successful, unavailable.Load())
+	}
+	if rate := res.ErrorRate(); rate < 0.35 || rate > 0.45 {
+		t.Errorf("error rate %.3f, want about 0.4", rate)
+	}
+}
+
+func TestNativeRunCutOff(t *testing.T) {
+	// Requests stall half way through the step, and are still outstanding
+	// when it ends
+	started := time.Now()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if time.Since(started) > 500*time.Millisecond {
+			stall(r)
+		}
+	}))
+	defer server.Close()
+
+	res, err := NewNativeGenerator(NewRequest(server.URL)).Run(2, 1)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.Errors != 0 || res.Completed == 0 {
+		t.Errorf("got %d completed and %d errors, want the stalled requests dropped", res.Completed, res.Errors)
+	}
+	if res.Duration > 2 {
+		t.Errorf("step took %.2fs, want it to end at 1s", res.Duration)
+	}
+}
+
+func TestNativeRunRate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(2 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	res, err := NewNativeGenerator(NewRequest(server.URL)).RunRate(200, 1)
+	if err != nil {
+		t.Fatalf("RunRate: %v", err)
+	}
+	if res.Completed != 200 || res.Errors != 0 {
+		t.Errorf("got %d completed and %d errors, want 200 scheduled requests", res.Completed, res.Errors)
+	}
+	if res.TargetRate != 200 || res.Duration != 1 || res.Throughput != 200 {
+		t.Errorf("got target rate %g, duration %gs and throughput %g, want 200 RPS over 1s", res.TargetRate, res.Duration, res.Throughput)
+	}
+	if !res.Corrected || res.Connections < 1 || res.Drain > 1 {
+		t.Errorf("got corrected %t, %d connections and drain %.2fs", res.Corrected, res.Connections, res.Drain)
+	}
+}
+
+func TestNativeRunRateInvalid(t *testing.T) {
+	generator := NewNativeGenerator(NewRequest("http://127.0.0.1:1"))
+	for _, rate := range []float64{0, -1, 2e9} {
+		if _, err := generator.RunRate(rate, 1); err == nil {
+			t.Errorf("RunRate(%g) succeeded, want an error", rate)
+		}
+	}
+}
+
+func TestNativeSourceExhausted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	source := func(limit int64) *NativeGenerator {
+		return NewNativeGenerator(&limitedSource{request: NewRequest(server.URL), limit: limit})
+	}
+
+	// Running out ends the step early with what was recorded
+	res, err := source(20).Run(2, 5)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.Completed < 1 || res.Completed > 20 || res.Duration > 2 {
+		t.Errorf("got %d completed in %.2fs, want at most 20 before the 5s step ends", res.Completed, res.Duration)
+	}
+	res, err = source(10).RunRate(100, 5)
+	if err != nil {
+		t.Fatalf("RunRate: %v", err)
+	}
+	if res.Completed != 10 || res.Duration > 1 {
+		t.Errorf("got %d completed over %.2fs, want 10 over the 0.1s schedule", res.Completed, res.Duration)
+	}
+
+	// A step that recorded nothing fails
+	if _, err := source(0).Run(2, 5); !errors.Is(err, ErrSourceExhausted) {
+		t.Errorf("Run with no requests: got %v, want ErrSourceExhausted", err)
+	}
+	if _, err := source(0).RunRate(100, 5); !errors.Is(err, ErrSourceExhausted) {
+		t.Errorf("RunRate with no requests: got %v, want ErrSourceExhausted", err)
+	}
+}
+
+func TestNativeWarmup(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stall" {
+			stall(r)
+		}
+	}))
+	defer server.Close()
+
+	if err := NewNativeGenerator(NewRequest(server.URL)).Warmup(); err != nil {
+		t.Errorf("Warmup: %v", err)
+	}
+
+	generator := NewNativeGenerator(NewRequest(server.URL + "/stall"))
+	generator.WarmupTimeout = 50 * time.Millisecond
+	started := time.Now()
+	if err := generator.Warmup(); err == nil {
+		t.Errorf("Warmup of a stalled server succeeded")
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("Warmup took %s, want it to time out after 50ms", elapsed)
+	}
+}
+
+func TestNativeRunCorrected(t *testing.T) {
+	// Most requests take 1-2ms, but the server stalls for 10-12ms every so
+	// often, which is where the closed-loop correction back-fills samples
+	var served atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := served.Add(1)
+		delay := time.Millisecond + time.Duration(n%3)*500*time.Microsecond
+		if n%40 == 0 {
+			delay = 10*time.Millisecond + time.Duration(n/40%5)*500*time.Microsecond
+		}
+		time.Sleep(delay)
+	}))
+	defer server.Close()
+
+	res, err := NewNativeGenerator(NewRequest(server.URL)).Run(4, 1)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !res.Corrected {
+		t.Fatal("closed-loop result is not corrected")
+	}
+	for _, percentile := range []LatencyPercentile{Latency90, Latency99, "99.9%", LatencyAvg} {
+		if corrected, raw := res.Latency(percentile), res.RawLatency(percentile); corrected < raw {
+			t.Errorf("corrected %s latency %.3fms is below the raw %.3fms", percentile, corrected, raw)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package loadtest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// SchemaVersion is the version of the JSON and CSV output. It is incremented
+// whenever a field is removed, renamed or changes meaning; adding fields keeps
+// the version.
+const SchemaVersion = 1
+
+// OutputFormats lists the formats accepted by Report.Write
+var OutputFormats = []string{"text", "json", "csv"}
+
+// Write writes the report in format, one of OutputFormats
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case "text":
+		return r.WriteText(w)
+	case "json":
+		return r.WriteJSON(w)
+	case "csv":
+		return r.WriteCSV(w)
+	}
+	return fmt.Errorf("unknown output format %q: must be one of %s", format, strings.Join(OutputFormats, ", "))
+}
+
+// reportJSON is the document written by WriteJSON: the report with the
+// schema version and a description of the model it predicted with.
+type reportJSON struct {
+	SchemaVersion int `json:"schema_version"`
+	*Report
+	Model *modelJSON `json:"model"`
+}
+
+type modelJSON struct {
+	Type            ModelType     `json:"type"`
+	Description     string        `json:"description"`
+	Coefficients    []Coefficient `json:"coefficients"`
+	ConditionNumber *float64      `json:"condition_number,omitempty"`
+}
+
+// WriteJSON writes the report, including every result, as a JSON document
+func (r *Report) WriteJSON(w io.Writer) error {
+	doc := reportJSON{SchemaVersion: SchemaVersion, Report: r}
+	if r.Model != nil {
+		doc.Model = &modelJSON{
+			Type:         r.Model.Name(),
+			Description:  r.Model.Describe(),
+			Coefficients: r.Model.Coefficients(),
+		}
+		if conditioned, ok := r.Model.(ConditionedModel); ok {
+			doc.Model.ConditionNumber = finite(conditioned.ConditionNumber())
+		}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	return nil
+}
+
+// MarshalJSON encodes the fit with its model's name. Statistics that could
+// not be computed are null, and the prediction is null unless it is valid.
+func (f *ModelFit) MarshalJSON() ([]byte, error) {
+	fit := struct {
+		Model           ModelType `json:"model"`
+		Params          int       `json:"params"`
+		R2              *float64  `json:"r2"`
+		RMSE            *float64  `json:"rmse_ms"`
+		AIC             *float64  `json:"aic"`
+		BIC             *float64  `json:"bic"`
+		ConditionNumber *float64  `json:"condition_number,omitempty"`
+		Prediction      *float64  `json:"prediction"`
+		Error           string    `json:"error,omitempty"`
+	}{Model: f.Model.Name(), Params: f.Model.NumParams()}
+
+	if f.Err == nil || f.RMSE != 0 {
+		fit.R2, fit.RMSE, fit.AIC, fit.BIC = finite(f.R2), finite(f.RMSE), finite(f.AIC), finite(f.BIC)
+		if conditioned, ok := f.Model.(ConditionedModel); ok {
+			fit.ConditionNumber = finite(conditioned.ConditionNumber())
+		}
+	}
+	if f.Err != nil {
+		fit.Error = f.Err.Error()
+	} else {
+		fit.Prediction = finite(f.Prediction)
+	}
+	return json.Marshal(fit)
+}
+
+// MarshalJSON encodes the step with the number of trials in place of the
+// trials themselves, which are in the report's results.
+func (s *StepStats) MarshalJSON() ([]byte, error) {
+	type stats StepStats
+	return json.Marshal(struct {
+		*stats
+		Trials int `json:"trials"`
+	}{(*stats)(s), len(s.Trials)})
+}
+
+// finite returns nil for values JSON cannot encode
+func finite(v float64) *float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return &v
+}
+
+// csvHeader lists the columns written by WriteCSV
+var csvHeader = []string{
+	"schema_version", "kind", "endpoint", "load_type", "load", "trial",
+	"throughput_rps", "avg_latency_ms", "min_latency_ms", "max_latency_ms",
+	"latency_50_ms", "latency_90_ms", "latency_98_ms", "latency_99_ms",
+	"completed", "successful", "errors", "error_rate", "connections", "sockets",
+	"target_rate_rps", "duration_s", "corrected", "implied_concurrency",
+	"model", "load_low", "load_high", "constraint",
+}
+
+// WriteCSV writes one row per result of kind "step", numbered by trial, and
+// "check", each followed by a row per endpoint for mixed requests. A final
+// row of kind "prediction" holds the predicted load and its throughput.
+// Columns that do not apply to a row are left empty.
+func (r *Report) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write(csvHeader)
+	loadType := strings.ToLower(r.LoadName())
+
+	writeResult := func(kind string, result *TestResult, trial string) {
+		writer.Write(csvResult(kind, "", loadType, result, trial))
+		for _, endpoint := range result.Endpoints {
+			writer.Write(csvResult(kind, endpoint.Name, loadType, endpoint, trial))
+		}
+	}
+	trial := 0
+	for i, result := range r.Results {
+		if i > 0 && result.Load() == r.Results[i-1].Load() {
+			trial++
+		} else {
+			trial = 1
+		}
+		writeResult("step", result, strconv.Itoa(trial))
+	}
+	if r.Check != nil {
+		writeResult("check", r.Check, "")
+	}
+
+	if p := r.Prediction; p != nil {
+		row := make([]string, len(csvHeader))
+		row[0], row[1], row[2], row[3] = strconv.Itoa(SchemaVersion), "prediction", r.Endpoint, loadType
+		row[4], row[6] = csvFloat(p.Load), csvFloat(p.RPS)
+		row[24], row[27] = string(p.Model), p.Constraint
+		if p.Samples > 0 {
+			row[25], row[26] = csvFloat(p.LoadLow), csvFloat(p.LoadHigh)
+		}
+		writer.Write(row)
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return nil
+}
+
+func csvResult(kind, endpoint, loadType string, result *TestResult, trial string) []string {
+	return []string{
+		strconv.Itoa(SchemaVersion), kind, endpoint, loadType, csvFloat(result.Load()), trial,
+		csvFloat(result.Throughput), csvFloat(result.AvgLatency), csvFloat(result.MinLatency), csvFloat(result.MaxLatency),
+		csvFloat(result.Latency50), csvFloat(result.Latency90), csvFloat(result.Latency98), csvFloat(result.Latency99),
+		strconv.Itoa(result.Completed), strconv.Itoa(result.Successful), strconv.Itoa(result.Errors), csvFloat(result.ErrorRate()),
+		strconv.Itoa(result.Connections), strconv.Itoa(result.Sockets),
+		csvFloat(result.TargetRate), csvFloat(result.Duration), strconv.FormatBool(result.Corrected), csvFloat(result.ImpliedConcurrency()),
+		"", "", "", "",
+	}
+}
+
+func csvFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
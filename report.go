@@ -0,0 +1,164 @@
+package loadtest
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Report is the outcome of a run: every measurement and the analysis of them.
+type Report struct {
+	TargetLatency     int               `json:"target_latency_ms"`
+	LatencyPercentile LatencyPercentile `json:"latency_percentile"`
+	MaxErrorRate      float64           `json:"max_error_rate"`
+	// Endpoint is the endpoint the analysis targets, "" for the aggregate
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Results holds every trial of every step in the order they ran, or
+	// sorted by load for a search
+	Results []*TestResult `json:"results"`
+	// Steps summarizes the trials of each step of the analyzed endpoint
+	Steps []*StepStats `json:"steps"`
+
+	// Fits compares every model, and Model is the one the prediction was made
+	// with. Selection explains the choice when the model was picked
+	// automatically.
+	Fits      []*ModelFit `json:"fits"`
+	Model     Model       `json:"-"`
+	Selection string      `json:"selection,omitempty"`
+	// Prediction is nil if no prediction could be made, with the reason in
+	// Error.
+	Prediction *Prediction `json:"prediction"`
+	Error      string      `json:"error,omitempty"`
+
+	// Check is the result of re-running the test at the predicted load, nil
+	// if the prediction was not checked. CheckPassed is set when it met both
+	// the target latency and the error rate limit.
+	Check       *TestResult `json:"check,omitempty"`
+	CheckPassed bool        `json:"check_passed"`
+
+	// MaxConcurrency is the highest concurrency a search measured to meet the
+	// target latency and error rate limit, 0 if none did or for other runs.
+	MaxConcurrency int `json:"max_concurrency,omitempty"`
+
+	// Assertions holds the outcome of every assertion checked with Assert
+	Assertions []*AssertionResult `json:"assertions,omitempty"`
+
+	// Plots lists the files of the generated plots
+	Plots    []string `json:"plots,omitempty"`
+	Warnings []string `json:"warnings"`
+
+	Started          time.Time     `json:"started"`
+	TestDuration     time.Duration `json:"test_duration_ns"`
+	AnalysisDuration time.Duration `json:"analysis_duration_ns"`
+}
+
+func (r *Report) warnf(format string, args ...any) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// LoadName returns "Concurrency" or "Rate" depending on how the tests were run
+func (r *Report) LoadName() string {
+	if len(r.Results) == 0 {
+		return "Concurrency"
+	}
+	return r.Results[0].LoadName()
+}
+
+// WriteText writes the analysis in human readable form
+func (r *Report) WriteText(w io.Writer) error {
+	loadName := r.LoadName()
+	lowerName := strings.ToLower(loadName)
+
+	// Trial statistics only add information for repeated trials
+	for _, step := range r.Steps {
+		if len(step.Trials) > 1 {
+			fmt.Fprintf(w, "\nStep Statistics:\n")
+			writeStepStatistics(w, r.Steps, loadName, r.LatencyPercentile)
+			break
+		}
+	}
+
+	if r.Prediction != nil {
+		for _, step := range r.Steps {
+			for _, load := range r.Prediction.Excluded {
+				if step.Load == load {
+					fmt.Fprintf(w, "Excluded %s %g from the fit: error rate %.2f%% exceeds %.2f%%\n", lowerName, step.Load, step.MeanErrorRate*100, r.MaxErrorRate*100)
+				}
+			}
+		}
+	}
+
+	if len(r.Fits) > 0 {
+		fmt.Fprintf(w, "\nModel Comparison (%s Latency):\n", r.LatencyPercentile)
+		writeModelComparison(w, r.Fits, loadName)
+		if r.Selection != "" {
+			fmt.Fprintf(w, "Selected model: %s (%s)\n", r.Model.Name(), r.Selection)
+		}
+	}
+
+	if p := r.Prediction; p != nil {
+		fmt.Fprintf(w, "\nAnalysis Results:\n")
+		if r.Model != nil {
+			fmt.Fprintln(w, r.Model.Describe())
+			if conditioned, ok := r.Model.(ConditionedModel); ok {
+				fmt.Fprintf(w, "Condition number: %.3g\n", conditioned.ConditionNumber())
+			}
+			level := p.Confidence * 100
+			switch {
+			case p.Constraint == "error rate":
+				fmt.Fprintf(w, "Predicted %s for %dms Latency: %.2f\n", loadName, r.TargetLatency, p.LatencyLoad)
+			case p.Samples == 0:
+				fmt.Fprintf(w, "Predicted %s for %dms Latency: %.2f\n", loadName, r.TargetLatency, p.Load)
+				fmt.Fprintf(w, "Predicted RPS for %dms (%s %.2f): %.2f\n", r.TargetLatency, loadName, p.Load, p.RPS)
+			default:
+				fmt.Fprintf(w, "Coefficients (%g%% confidence intervals from %d bootstrap samples):\n%s\n", level, p.Samples, p.describeCoefficients())
+				fmt.Fprintf(w, "Predicted %s for %dms Latency: %.2f (%g%% CI %.2f - %.2f)\n", loadName, r.TargetLatency, p.Load, level, p.LoadLow, p.LoadHigh)
+				fmt.Fprintf(w, "Predicted RPS for %dms (%s %.2f): %.2f (%g%% CI %.2f - %.2f)\n", r.TargetLatency, loadName, p.Load, p.RPS, level, p.RPSLow, p.RPSHigh)
+			}
+		}
+		if p.ErrorRateLoad > 0 {
+			fmt.Fprintf(w, "Error rate exceeds %.2f%% above %s %.2f\n", r.MaxErrorRate*100, lowerName, p.ErrorRateLoad)
+		}
+		if p.Constraint == "error rate" {
+			fmt.Fprintf(w, "Predicted %s limited by %.2f%% error rate: %.2f\n", loadName, r.MaxErrorRate*100, p.Load)
+			fmt.Fprintf(w, "Predicted RPS at %s %.2f: %.2f\n", loadName, p.Load, p.RPS)
+		}
+		if p.SaturationLoad > 0 {
+			fmt.Fprintf(w, "Throughput saturates above %s %g (%.2f RPS)\n", lowerName, p.SaturationLoad, p.SaturationRPS)
+		} else {
+			fmt.Fprintln(w, "Throughput did not saturate within the tested range")
+		}
+		if p.KneeLoad > 0 {
+			fmt.Fprintf(w, "Latency knee at %s %.2f (%.2fms)\n", lowerName, p.KneeLoad, p.KneeLatency)
+		}
+	}
+
+	if r.Check != nil {
+		outcome := "failed"
+		if r.CheckPassed {
+			outcome = "passed"
+		}
+		fmt.Fprintf(w, "\nCheck at predicted %s %g %s: %s\n", lowerName, r.Check.Load(), outcome, r.Check.Print(r.LatencyPercentile))
+	}
+
+	if len(r.Assertions) > 0 {
+		fmt.Fprintf(w, "\nAssertions:\n")
+		for _, assertion := range r.Assertions {
+			outcome := "FAIL"
+			if assertion.Passed {
+				outcome = "PASS"
+			}
+			fmt.Fprintf(w, "%s  %s (%s)\n", outcome, assertion.Assertion, assertion.Detail)
+		}
+	}
+
+	if len(r.Plots) > 0 {
+		fmt.Fprintf(w, "Plots generated: %s\n", strings.Join(r.Plots, ", "))
+	}
+	for _, warning := range r.Warnings {
+		fmt.Fprintf(w, "Warning: %s\n", warning)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package loadtest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Request describes the HTTP request sent by a load generator. Label groups
+// requests into endpoints, which get their own results when a test sends more
+// than one.
+type Request struct {
+	Label  string
+	Method string
+	URL    string
+	Header http.Header
+	Body   []byte
+}
+
+func NewRequest(url string) *Request {
+	return &Request{
+		Method: http.MethodGet,
+		URL:    url,
+		Header: http.Header{},
+	}
+}
+
+// AddHeader adds a header given as "Name: value"
+func (r *Request) AddHeader(line string) error {
+	name, value, ok := strings.Cut(line, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return fmt.Errorf("invalid header %q, expected \"Name: value\"", line)
+	}
+	r.Header.Add(name, strings.TrimSpace(value))
+	return nil
+}
+
+// httpRequest builds a net/http request, which cannot be reused across sends
+// because of its body.
+func (r *Request) httpRequest() (*http.Request, error) {
+	var body io.Reader
+	if len(r.Body) > 0 {
+		body = bytes.NewReader(r.Body)
+	}
+	req, err := http.NewRequest(r.Method, r.URL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	for name, values := range r.Header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	if host := r.Header.Get("Host"); host != "" {
+		req.Host = host
+	}
+	return req, nil
+}
+
+// RequestSource supplies the requests sent during a test. Each virtual user
+// (a closed-loop worker, or the scheduler in open-loop mode) draws from its own
+// iterator.
+type RequestSource interface {
+	NewUser(id int) RequestIterator
+}
+
+type RequestIterator interface {
+	Next() (*Request, error)
+}
+
+// ErrSourceExhausted is returned, possibly wrapped, by a RequestIterator that
+// has no requests left to send. A step that runs out ends early with the
+// requests it sent.
+var ErrSourceExhausted = errors.New("no requests left")
+
+// WarmupSource is implemented by sources whose requests draw on shared data,
+// such as the rows of a Feeder, to supply the warmup request without using
+// any of it up.
+type WarmupSource interface {
+	WarmupRequest() (*Request, error)
+}
+
+// NewUser makes a single Request usable as a RequestSource that always
+// returns itself.
+func (r *Request) NewUser(id int) RequestIterator {
+	return r
+}
+
+func (r *Request) Next() (*Request, error) {
+	return r, nil
+}
@@ -17,24 +17,141 @@ const (
 	LatencyAvg LatencyPercentile = "avg"
 )
 
+// ParseLatencyPercentile parses percentiles such as "90", "90%", "p90" or
+// "avg". Only the LatencyPercentile constants are accepted unless histograms
+// is set, in which case any percentile in (0, 100] is allowed.
+func ParseLatencyPercentile(s string, histograms bool) (LatencyPercentile, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	if s == string(LatencyAvg) {
+		return LatencyAvg, nil
+	}
+	p := LatencyPercentile(strings.TrimSuffix(strings.TrimPrefix(s, "p"), "%") + "%")
+	value, err := p.Value()
+	if err != nil {
+		return "", fmt.Errorf("invalid latency percentile %q: must be avg or a percentile in (0, 100]", s)
+	}
+	// Normalize values such as "90.0%" to match the fixed constants
+	p = LatencyPercentile(strconv.FormatFloat(value, 'f', -1, 64) + "%")
+
+	switch p {
+	case Latency50, Latency90, Latency98, Latency99:
+		return p, nil
+	}
+	if !histograms {
+		return "", fmt.Errorf("latency percentile %q is not supported without histograms (use 50, 90, 98, 99 or avg)", s)
+	}
+	return p, nil
+}
+
+// Value returns the numeric percentile (0-100] for values such as "99.9%" or
+// "99.9". It fails for LatencyAvg.
+func (p LatencyPercentile) Value() (float64, error) {
+	value, err := strconv.ParseFloat(strings.TrimSuffix(string(p), "%"), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid latency percentile %q", p)
+	}
+	if value <= 0 || value > 100 {
+		return 0, fmt.Errorf("latency percentile %q is out of range (0, 100]", p)
+	}
+	return value, nil
+}
+
 // name,throughput,avg. latency,threads,connections,duration,completed,successful,errors,sockets,min. latency,max. latency,50%,90%,98%,99%
 type TestResult struct {
-	Name        string
-	Throughput  float64
-	AvgLatency  float64
-	Threads     int
-	Connections int
-	Duration    float64
-	Completed   int
-	Successful  int
-	Errors      int
-	Sockets     int
-	MinLatency  float64
-	MaxLatency  float64
-	Latency50   float64
-	Latency90   float64
-	Latency98   float64
-	Latency99   float64
+	Name        string  `json:"name"`
+	Throughput  float64 `json:"throughput_rps"`
+	AvgLatency  float64 `json:"avg_latency_ms"`
+	Threads     int     `json:"threads"`
+	Connections int     `json:"connections"`
+	Duration    float64 `json:"duration_s"`
+	Completed   int     `json:"completed"`
+	Successful  int     `json:"successful"`
+	Errors      int     `json:"errors"`
+	Sockets     int     `json:"sockets"`
+	MinLatency  float64 `json:"min_latency_ms"`
+	MaxLatency  float64 `json:"max_latency_ms"`
+	Latency50   float64 `json:"latency_50_ms"`
+	Latency90   float64 `json:"latency_90_ms"`
+	Latency98   float64 `json:"latency_98_ms"`
+	Latency99   float64 `json:"latency_99_ms"`
+
+	// TargetRate is the scheduled request rate for open-loop tests and zero
+	// for fixed concurrency tests.
+	TargetRate float64 `json:"target_rate_rps,omitempty"`
+	// Drain is how long the requests outstanding at the end of an open-loop
+	// schedule took to complete, after Duration.
+	Drain float64 `json:"drain_s,omitempty"`
+
+	// Corrected is set when the latency fields above have been corrected for
+	// coordinated omission, i.e. measured from each request's intended send
+	// time rather than from when it was actually sent. The uncorrected values
+	// are kept in the Raw fields.
+	Corrected     bool    `json:"corrected,omitempty"`
+	RawAvgLatency float64 `json:"raw_avg_latency_ms,omitempty"`
+	RawMinLatency float64 `json:"raw_min_latency_ms,omitempty"`
+	RawMaxLatency float64 `json:"raw_max_latency_ms,omitempty"`
+	RawLatency50  float64 `json:"raw_latency_50_ms,omitempty"`
+	RawLatency90  float64 `json:"raw_latency_90_ms,omitempty"`
+	RawLatency98  float64 `json:"raw_latency_98_ms,omitempty"`
+	RawLatency99  float64 `json:"raw_latency_99_ms,omitempty"`
+
+	// Histogram holds the full latency distribution when the load generator
+	// records one, so arbitrary percentiles can be read with Latency.
+	// RawHistogram is its uncorrected counterpart for corrected results.
+	Histogram    *Histogram `json:"histogram,omitempty"`
+	RawHistogram *Histogram `json:"raw_histogram,omitempty"`
+
+	// Endpoints holds a result per request label, sorted by name, when the
+	// test mixed requests to more than one endpoint. The fields above are the
+	// aggregate over all of them.
+	Endpoints []*TestResult `json:"endpoints,omitempty"`
+}
+
+// Endpoint returns the result for the endpoint labelled name, or nil
+func (r *TestResult) Endpoint(name string) *TestResult {
+	for _, endpoint := range r.Endpoints {
+		if endpoint.Name == name {
+			return endpoint
+		}
+	}
+	return nil
+}
+
+// SetHistograms fills the latency fields from a histogram. When raw is not nil
+// hist is taken to be corrected for coordinated omission and raw holds the
+// uncorrected values. Corrected latencies are never below the raw ones: a
+// correction that back-fills samples shorter than the stall they came from
+// can otherwise pull the upper percentiles down.
+func (r *TestResult) SetHistograms(hist, raw *Histogram) {
+	r.Histogram = hist
+	r.AvgLatency = hist.Mean()
+	r.MinLatency = hist.Percentile(0)
+	r.MaxLatency = hist.Percentile(100)
+	r.Latency50 = hist.Percentile(50)
+	r.Latency90 = hist.Percentile(90)
+	r.Latency98 = hist.Percentile(98)
+	r.Latency99 = hist.Percentile(99)
+
+	if raw == nil {
+		return
+	}
+	r.Corrected = true
+	r.RawHistogram = raw
+	r.RawAvgLatency = raw.Mean()
+	r.RawMinLatency = raw.Percentile(0)
+	r.RawMaxLatency = raw.Percentile(100)
+	r.RawLatency50 = raw.Percentile(50)
+	r.RawLatency90 = raw.Percentile(90)
+	r.RawLatency98 = raw.Percentile(98)
+	r.RawLatency99 = raw.Percentile(99)
+
+	r.AvgLatency = max(r.AvgLatency, r.RawAvgLatency)
+	r.MinLatency = max(r.MinLatency, r.RawMinLatency)
+	r.MaxLatency = max(r.MaxLatency, r.RawMaxLatency)
+	r.Latency50 = max(r.Latency50, r.RawLatency50)
+	r.Latency90 = max(r.Latency90, r.RawLatency90)
+	r.Latency98 = max(r.Latency98, r.RawLatency98)
+	r.Latency99 = max(r.Latency99, r.RawLatency99)
 }
 
 func (r *TestResult) String() string {
@@ -42,7 +159,11 @@ func (r *TestResult) String() string {
 	if r.Name != "" {
 		sb.WriteString(fmt.Sprintf("Test: %s\n", r.Name))
 	}
+	if r.TargetRate > 0 {
+		sb.WriteString(fmt.Sprintf("Target Rate: %.2f RPS\n", r.TargetRate))
+	}
 	sb.WriteString(fmt.Sprintf("Concurrency: %d\n", r.Connections))
+	sb.WriteString(fmt.Sprintf("Implied Concurrency: %.2f\n", r.ImpliedConcurrency()))
 	sb.WriteString(fmt.Sprintf("Throughput: %.2f RPS\n", r.Throughput))
 	sb.WriteString(fmt.Sprintf("Avg. Latency: %.2fms\n", r.AvgLatency))
 	sb.WriteString(fmt.Sprintf("Min Latency: %.2fms\n", r.MinLatency))
@@ -51,8 +172,20 @@ func (r *TestResult) String() string {
 	sb.WriteString(fmt.Sprintf("90%% Latency: %.2fms\n", r.Latency90))
 	sb.WriteString(fmt.Sprintf("98%% Latency: %.2fms\n", r.Latency98))
 	sb.WriteString(fmt.Sprintf("99%% Latency: %.2fms\n", r.Latency99))
+	if r.Corrected {
+		sb.WriteString(fmt.Sprintf("Raw Avg. Latency: %.2fms\n", r.RawAvgLatency))
+		sb.WriteString(fmt.Sprintf("Raw Min Latency: %.2fms\n", r.RawMinLatency))
+		sb.WriteString(fmt.Sprintf("Raw Max Latency: %.2fms\n", r.RawMaxLatency))
+		sb.WriteString(fmt.Sprintf("Raw 50%% Latency: %.2fms\n", r.RawLatency50))
+		sb.WriteString(fmt.Sprintf("Raw 90%% Latency: %.2fms\n", r.RawLatency90))
+		sb.WriteString(fmt.Sprintf("Raw 98%% Latency: %.2fms\n", r.RawLatency98))
+		sb.WriteString(fmt.Sprintf("Raw 99%% Latency: %.2fms\n", r.RawLatency99))
+	}
 	sb.WriteString(fmt.Sprintf("Threads: %d\n", r.Threads))
 	sb.WriteString(fmt.Sprintf("Duration: %.2fs\n", r.Duration))
+	if r.Drain > 0 {
+		sb.WriteString(fmt.Sprintf("Drain: %.2fs\n", r.Drain))
+	}
 	sb.WriteString(fmt.Sprintf("Completed: %d\n", r.Completed))
 	sb.WriteString(fmt.Sprintf("Successful: %d\n", r.Successful))
 	sb.WriteString(fmt.Sprintf("Errors: %d\n", r.Errors))
@@ -61,9 +194,47 @@ func (r *TestResult) String() string {
 }
 
 func (r *TestResult) Print(latencyPercentile LatencyPercentile) string {
-	return fmt.Sprintf("Concurrency: %d, Throughput: %.2f RPS, Latency: %.2fms (%s)", r.Connections, r.Throughput, r.Latency(latencyPercentile), latencyPercentile)
+	latency := fmt.Sprintf("Latency: %.2fms (%s)", r.Latency(latencyPercentile), latencyPercentile)
+	if r.Corrected {
+		latency = fmt.Sprintf("Latency: %.2fms (%s, raw %.2fms)", r.Latency(latencyPercentile), latencyPercentile, r.RawLatency(latencyPercentile))
+	}
+	if r.TargetRate > 0 {
+		return fmt.Sprintf("Target Rate: %.2f RPS, Throughput: %.2f RPS, %s", r.TargetRate, r.Throughput, latency)
+	}
+	return fmt.Sprintf("Concurrency: %d (implied %.2f), Throughput: %.2f RPS, %s", r.Connections, r.ImpliedConcurrency(), r.Throughput, latency)
+}
+
+// Load returns the independent variable of the test: the target rate for
+// open-loop tests, otherwise the number of connections.
+func (r *TestResult) Load() float64 {
+	if r.TargetRate > 0 {
+		return r.TargetRate
+	}
+	return float64(r.Connections)
+}
+
+// ErrorRate returns the fraction of requests that failed or got a non-2xx
+// response.
+func (r *TestResult) ErrorRate() float64 {
+	total := r.Completed + r.Errors
+	if total == 0 {
+		return 0
+	}
+	return float64(total-r.Successful) / float64(total)
+}
+
+// LoadName names the load returned by Load: "Rate" or "Concurrency".
+func (r *TestResult) LoadName() string {
+	if r.TargetRate > 0 {
+		return "Rate"
+	}
+	return "Concurrency"
 }
 
+// Latency returns the latency in ms at percentile. Percentiles other than the
+// LatencyPercentile constants, such as "99.9%", are only available when the
+// result has a Histogram; -1 is returned otherwise. Like the fixed ones, they
+// are never below the raw latency for corrected results.
 func (r *TestResult) Latency(percentile LatencyPercentile) float64 {
 	switch percentile {
 	case Latency50:
@@ -77,8 +248,47 @@ func (r *TestResult) Latency(percentile LatencyPercentile) float64 {
 	case LatencyAvg:
 		return r.AvgLatency
 	default:
+		latency := histogramLatency(r.Histogram, percentile)
+		if r.Corrected && latency >= 0 {
+			latency = max(latency, histogramLatency(r.RawHistogram, percentile))
+		}
+		return latency
+	}
+}
+
+// RawLatency returns the latency for percentile without coordinated omission
+// correction. For uncorrected results it is the same as Latency.
+func (r *TestResult) RawLatency(percentile LatencyPercentile) float64 {
+	if !r.Corrected {
+		return r.Latency(percentile)
+	}
+	switch percentile {
+	case Latency50:
+		return r.RawLatency50
+	case Latency90:
+		return r.RawLatency90
+	case Latency98:
+		return r.RawLatency98
+	case Latency99:
+		return r.RawLatency99
+	case LatencyAvg:
+		return r.RawAvgLatency
+	default:
+		return histogramLatency(r.RawHistogram, percentile)
+	}
+}
+
+// histogramLatency reads percentiles other than the fixed ones from a
+// histogram, returning -1 when there is none or the percentile is invalid.
+func histogramLatency(hist *Histogram, percentile LatencyPercentile) float64 {
+	if hist == nil {
+		return -1
+	}
+	value, err := percentile.Value()
+	if err != nil {
 		return -1
 	}
+	return hist.Percentile(value)
 }
 
 func parseCSVOutput(output string) (*TestResult, error) {
@@ -87,8 +297,7 @@ func parseCSVOutput(output string) (*TestResult, error) {
 	// name,throughput,avg. latency,threads,connections,duration,completed,successful,errors,sockets,min. latency,max. latency,50%,90%,98%,99%
 	records, err := reader.ReadAll()
 	if err != nil {
-		fmt.Println(output)
-		return nil, fmt.Errorf("could not read CSV records: %w", err)
+		return nil, fmt.Errorf("could not read CSV records: %w\nOutput: %s", err, output)
 	}
 	if len(records) == 0 {
 		return nil, fmt.Errorf("no records found in CSV output")
@@ -1,12 +1,15 @@
 package loadtest
 
 import (
-	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"image/color"
+	"io"
 	"math"
-	"os/exec"
-	"strconv"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -17,208 +20,431 @@ import (
 )
 
 type Runner struct {
-	URL               string
+	Generator         LoadGenerator
 	Duration          int
 	TargetLatency     int
 	LatencyPercentile LatencyPercentile
 	ConcurrencySteps  []int
 	CheckPrediction   bool
 	Plot              bool
+
+	// RateSteps switches the runner to open-loop mode: each step issues
+	// requests at the given rate (RPS) regardless of response time, and the
+	// prediction is the maximum rate that meets TargetLatency. Requires a
+	// RateGenerator.
+	RateSteps []float64
+
+	// HistogramDir, when set, is where every step's result (including its
+	// latency histogram, if the generator records one) is saved as JSON.
+	HistogramDir string
+
+	// Endpoint, when set, makes the analysis target the results for requests
+	// with this label instead of the aggregate over all requests.
+	Endpoint string
+
+	// Model is the regression used to predict the load at TargetLatency,
+	// ModelAuto to pick the best fitting one
+	Model ModelType
+
+	// Search settings used by Search: the first concurrency, the factor it
+	// grows by, the concurrency bisection stops within, and an optional cap.
+	SearchStart     int
+	SearchFactor    float64
+	SearchTolerance int
+	SearchMax       int
+
+	// Repetitions is the number of trials run at every step. Every trial is
+	// fitted, and steps whose latency coefficient of variation across trials
+	// exceeds MaxCV are flagged as unstable.
+	Repetitions int
+	MaxCV       float64
+
+	// MaxErrorRate is the highest fraction of failed and non-2xx requests a
+	// step may have. Steps above it are left out of the latency fit, and the
+	// prediction is capped where the error rate crosses it.
+	MaxErrorRate float64
+
+	// SaturationThreshold is the fraction of the first step's RPS per unit of
+	// load below which the marginal RPS of added load counts as saturated.
+	SaturationThreshold float64
+
+	// LittlesLawTolerance is how far the concurrency implied by Little's law
+	// may be from the configured concurrency, as a fraction, before a step is
+	// flagged. See TestResult.ImpliedConcurrency.
+	LittlesLawTolerance float64
+
+	// WeightBandwidth, when positive, weights observations in the fit by how
+	// close their latency is to TargetLatency, see observationsFor. Smaller
+	// values concentrate the weight near the target.
+	WeightBandwidth float64
+
+	// BootstrapSamples is the number of bootstrap refits used to estimate
+	// confidence intervals on the prediction, 0 to skip them. Confidence is
+	// the level of the intervals.
+	BootstrapSamples int
+	Confidence       float64
+
+	// Progress is where the progress of the tests is printed, os.Stdout by
+	// default.
+	Progress io.Writer
 }
 
-func NewRunner(url string, duration, targetLatency int, latencyPercentile LatencyPercentile, concurrency []int, checkPrediction, plot bool) *Runner {
+func NewRunner(generator LoadGenerator, duration, targetLatency int, latencyPercentile LatencyPercentile, concurrency []int, checkPrediction, plot bool) *Runner {
 	return &Runner{
-		URL:               url,
-		Duration:          duration,
-		TargetLatency:     targetLatency,
-		LatencyPercentile: latencyPercentile,
-		ConcurrencySteps:  concurrency,
-		CheckPrediction:   checkPrediction,
-		Plot:              plot,
+		Generator:           generator,
+		Duration:            duration,
+		TargetLatency:       targetLatency,
+		LatencyPercentile:   latencyPercentile,
+		ConcurrencySteps:    concurrency,
+		CheckPrediction:     checkPrediction,
+		Plot:                plot,
+		Model:               ModelAuto,
+		SearchStart:         1,
+		SearchFactor:        2,
+		SearchTolerance:     1,
+		MaxErrorRate:        0.01,
+		SaturationThreshold: 0.1,
+		LittlesLawTolerance: 0.2,
+		Repetitions:         1,
+		MaxCV:               0.1,
+		BootstrapSamples:    1000,
+		Confidence:          0.95,
+		Progress:            os.Stdout,
 	}
 }
 
-func (r *Runner) Run() (float64, error) {
+// Run tests every step and predicts the load at TargetLatency. The report is
+// returned along with any error once the steps have run, so the measurements
+// are not lost when the analysis fails.
+func (r *Runner) Run() (*Report, error) {
+	if len(r.RateSteps) > 0 {
+		if _, ok := r.Generator.(RateGenerator); !ok {
+			return nil, fmt.Errorf("load generator %T does not support arrival-rate tests", r.Generator)
+		}
+	}
+
 	// Warmup request
-	if err := runAPIBWarmup(r.URL); err != nil {
-		return 0, fmt.Errorf("warmup failed: %w", err)
+	if err := r.Generator.Warmup(); err != nil {
+		return nil, fmt.Errorf("warmup failed: %w", err)
 	}
 
-	// Run tests for each concurrency level
+	// Run tests for each concurrency level or target rate
+	started := time.Now()
 	results := []*TestResult{}
-	for _, concurrency := range r.ConcurrencySteps {
-		// Make sure to drain connections between runs
-		if err := waitForConnectionsToClear(100); err != nil {
-			return 0, fmt.Errorf("failed to check existing connections: %w", err)
+	var exhausted error
+	for _, load := range r.steps() {
+		trials, err := r.measureTrials(load)
+		results = append(results, trials...)
+		if errors.Is(err, ErrSourceExhausted) {
+			// Every later step would run out too
+			r.printf("%v\n", err)
+			exhausted = err
+			break
 		}
-		fmt.Printf("Running test with concurrency %d...\n", concurrency)
-		result, err := runAPIB(concurrency, r.Duration, r.URL)
 		if err != nil {
-			fmt.Printf("Test failed for concurrency %d: %v\n", concurrency, err)
-			continue
+			return nil, err
 		}
-		results = append(results, result)
-		fmt.Println(result.Print(r.LatencyPercentile))
 	}
+	tested := time.Since(started)
 
 	// Analyze and predict
-	predictedConcurrency, err := analyzeAndPredict(r.TargetLatency, r.LatencyPercentile, results)
+	report, err := r.Analyze(results)
+	report.Started, report.TestDuration = started, tested
+	if exhausted != nil {
+		report.warnf("the remaining steps were skipped: %v", exhausted)
+	}
 	if err != nil {
-		return 0, fmt.Errorf("failed to analyze results: %w", err)
+		return report, fmt.Errorf("failed to analyze results: %w", err)
 	}
-
-	if r.CheckPrediction {
-		rounded := int(math.Round(predictedConcurrency))
-		fmt.Printf("Re-running tests to check predicted concurrency %f (rounded to %d)\n", predictedConcurrency, rounded)
-		result, err := runAPIB(rounded, r.Duration, r.URL)
+	predictedLoad := report.Prediction.Load
+
+	if r.CheckPrediction && exhausted != nil {
+		report.warnf("the prediction was not checked, the request source is exhausted")
+	} else if r.CheckPrediction {
+		checkLoad := predictedLoad
+		if len(r.RateSteps) == 0 {
+			checkLoad = math.Round(predictedLoad)
+		}
+		r.printf("Re-running tests to check predicted %s %f (rounded to %g)\n", r.loadName(), predictedLoad, checkLoad)
+		result, err := r.runStep(checkLoad)
 		if err != nil {
-			return 0, fmt.Errorf("test failed for predicted concurrency %.2f: %w", predictedConcurrency, err)
-		} else {
-			results = append(results, result)
-			fmt.Println(result.Print(r.LatencyPercentile))
+			return report, fmt.Errorf("test failed for predicted %s %.2f: %w", r.loadName(), predictedLoad, err)
 		}
-
+		r.printResult(result)
+		if err := r.saveResult(result, "check-", ""); err != nil {
+			return report, err
+		}
+		report.Check = result
+		checked, err := endpointResults([]*TestResult{result}, r.Endpoint)
+		if err != nil {
+			return report, err
+		}
+		report.CheckPassed = checked[0].Latency(r.LatencyPercentile) <= float64(r.TargetLatency) && checked[0].ErrorRate() <= r.MaxErrorRate
 	}
 
 	// Generate plots if requested
 	if r.Plot {
-		if err := plotResults(results, r.TargetLatency, r.LatencyPercentile); err != nil {
-			return 0, err
+		if err := r.PlotReport(report); err != nil {
+			return report, err
 		}
 	}
 
-	return predictedConcurrency, nil
+	return report, nil
 }
 
-func runAPIB(concurrency, duration int, url string) (*TestResult, error) {
-	cmd := exec.Command("apib", "-S", "-c", fmt.Sprint(concurrency), "-d", fmt.Sprint(duration), url)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("failed to execute apib: %w\nStdout: %s\nStderr: %s", err, stdout.String(), stderr.String())
+// PlotReport plots the results of the report, and its check if there is one,
+// against the model it predicted with, and lists the files in report.Plots.
+// Reports without a model are left unplotted.
+func (r *Runner) PlotReport(report *Report) error {
+	if report.Model == nil {
+		return nil
+	}
+	results, err := endpointResults(report.Results, r.Endpoint)
+	if err != nil {
+		return err
+	}
+	var check *TestResult
+	if report.Check != nil {
+		checked, err := endpointResults([]*TestResult{report.Check}, r.Endpoint)
+		if err != nil {
+			return err
+		}
+		check = checked[0]
+	}
+	var excluded []float64
+	if report.Prediction != nil {
+		excluded = report.Prediction.Excluded
 	}
+	report.Plots, err = plotResults(report.Model, results, excluded, check, r.TargetLatency, r.LatencyPercentile)
+	return err
+}
 
-	if stderr.Len() > 0 {
-		fmt.Println("Warning: apib produced stderr output:\n", stderr.String())
+// errStepFailed marks errors from the load generator itself, after which the
+// remaining steps can still be run.
+var errStepFailed = errors.New("test failed")
+
+// measureTrials runs Repetitions trials of a single step. Trials the load
+// generator fails on are reported and skipped, unless the request source ran
+// out, which is returned with the trials run before.
+func (r *Runner) measureTrials(load float64) ([]*TestResult, error) {
+	trials := []*TestResult{}
+	for trial := 1; trial <= max(r.Repetitions, 1); trial++ {
+		result, err := r.measure(load, trial)
+		if errors.Is(err, ErrSourceExhausted) {
+			return trials, err
+		}
+		if errors.Is(err, errStepFailed) {
+			r.printf("%v\n", err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		trials = append(trials, result)
 	}
+	return trials, nil
+}
 
-	output := stdout.String()
-	return parseCSVOutput(output)
+// measure runs a single trial of a step at load, once the connections from
+// previous steps have drained for generators that need them to, then prints
+// and saves its result.
+func (r *Runner) measure(load float64, trial int) (*TestResult, error) {
+	// Make sure to drain connections between runs
+	if drainer, ok := r.Generator.(ConnectionDrainer); ok {
+		if err := drainer.DrainConnections(r.progress()); err != nil {
+			return nil, fmt.Errorf("failed to check existing connections: %w", err)
+		}
+	}
+	if r.Repetitions > 1 {
+		r.printf("Running test with %s %g (trial %d/%d)...\n", r.loadName(), load, trial, r.Repetitions)
+	} else {
+		r.printf("Running test with %s %g...\n", r.loadName(), load)
+	}
+	result, err := r.runStep(load)
+	if err != nil {
+		return nil, fmt.Errorf("%w for %s %g: %w", errStepFailed, r.loadName(), load, err)
+	}
+	if result.Latency(r.LatencyPercentile) < 0 {
+		return nil, fmt.Errorf("latency percentile %q is not available in results from %T", r.LatencyPercentile, r.Generator)
+	}
+	r.printResult(result)
+	suffix := ""
+	if r.Repetitions > 1 {
+		suffix = fmt.Sprintf("-trial%d", trial)
+	}
+	if err := r.saveResult(result, "", suffix); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
-func runAPIBWarmup(url string) error {
-	cmd := exec.Command("apib", "-S", "-1", url)
-	var out bytes.Buffer
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to execute apib: %w\nOutput: %s", err, out.String())
+// steps returns the load levels to test, in target rates when RateSteps is
+// set and in connections otherwise.
+func (r *Runner) steps() []float64 {
+	if len(r.RateSteps) > 0 {
+		return r.RateSteps
+	}
+	steps := make([]float64, len(r.ConcurrencySteps))
+	for i, concurrency := range r.ConcurrencySteps {
+		steps[i] = float64(concurrency)
 	}
+	return steps
+}
 
-	if stderr.Len() > 0 {
-		return fmt.Errorf("apib produced stderr output: %s", stderr.String())
+func (r *Runner) runStep(load float64) (*TestResult, error) {
+	if len(r.RateSteps) > 0 {
+		return r.Generator.(RateGenerator).RunRate(load, r.Duration)
 	}
+	return r.Generator.Run(int(load), r.Duration)
+}
 
-	return nil
+func (r *Runner) progress() io.Writer {
+	if r.Progress == nil {
+		return io.Discard
+	}
+	return r.Progress
 }
 
-func waitForConnectionsToClear(threshold int) error {
-	for {
-		cmd := exec.Command("sh", "-c", "netstat -an | grep TIME_WAIT | wc -l")
-		out, err := cmd.Output()
-		if err != nil {
-			return fmt.Errorf("failed to execute netstat: %w", err)
-		}
+func (r *Runner) printf(format string, args ...any) {
+	fmt.Fprintf(r.progress(), format, args...)
+}
 
-		// Parse the number of TIME_WAIT connections
-		count, err := strconv.Atoi(strings.TrimSpace(string(out)))
-		if err != nil {
-			return fmt.Errorf("failed to parse TIME_WAIT count: %w", err)
-		}
+func (r *Runner) loadName() string {
+	if len(r.RateSteps) > 0 {
+		return "rate"
+	}
+	return "concurrency"
+}
 
-		if count <= threshold {
-			break
-		}
+// printResult prints a one-line summary of result, followed by one per
+// endpoint for mixed requests.
+func (r *Runner) printResult(result *TestResult) {
+	r.printf("%s\n", result.Print(r.LatencyPercentile))
+	for _, endpoint := range result.Endpoints {
+		r.printf("  %s: %s\n", endpoint.Name, endpoint.Print(r.LatencyPercentile))
+	}
+}
 
-		fmt.Printf("Waiting for connections to clear: %d TIME_WAIT\n", count)
-		time.Sleep(5 * time.Second) // Adjust as needed
+// saveResult writes result to HistogramDir as <prefix><rate|concurrency>-<load><suffix>.json
+func (r *Runner) saveResult(result *TestResult, prefix, suffix string) error {
+	if r.HistogramDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(r.HistogramDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create histogram directory: %w", err)
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode result: %w", err)
+	}
+	name := fmt.Sprintf("%s%s-%g%s.json", prefix, strings.ToLower(result.LoadName()), result.Load(), suffix)
+	if err := os.WriteFile(filepath.Join(r.HistogramDir, name), data, 0o644); err != nil {
+		return fmt.Errorf("failed to save result: %w", err)
 	}
 	return nil
 }
 
-func plotResults(results []*TestResult, targetLatency int, latencyPercentile LatencyPercentile) error {
+// plotResults plots the results against model and returns the files written.
+// Steps at the excluded loads were left out of the fit and are marked apart
+// from the fitted ones, as is the check, which may be nil.
+func plotResults(model Model, results []*TestResult, excluded []float64, check *TestResult, targetLatency int, latencyPercentile LatencyPercentile) ([]string, error) {
 	// Prepare data points for plots
-	performancePts := make(plotter.XYs, len(results))
+	performancePts := plotter.XYs{}
+	excludedPts := plotter.XYs{}
 	rpsPts := make(plotter.XYs, len(results))
+	maxConcurrency := 0.0
 
 	for i, res := range results {
-		performancePts[i].X = float64(res.Connections)
-		performancePts[i].Y = res.Latency(latencyPercentile)
-		rpsPts[i].X = float64(res.Connections)
+		point := plotter.XY{X: res.Load(), Y: res.Latency(latencyPercentile)}
+		if slices.Contains(excluded, res.Load()) {
+			excludedPts = append(excludedPts, point)
+		} else {
+			performancePts = append(performancePts, point)
+		}
+		rpsPts[i].X = res.Load()
 		rpsPts[i].Y = res.Throughput
+		maxConcurrency = math.Max(maxConcurrency, res.Load())
+	}
+	if check != nil {
+		maxConcurrency = math.Max(maxConcurrency, check.Load())
 	}
+	fitName := fmt.Sprintf("%s Fit", strings.ToUpper(string(model.Name())[:1])+string(model.Name())[1:])
 
-	// Perform quadratic regression
-	a, b, c, err := quadraticRegression(results, latencyPercentile)
+	// Predict the load at the target latency
+	predictedConcurrency, err := model.Solve(float64(targetLatency))
 	if err != nil {
-		return fmt.Errorf("failed to compute quadratic regression for plotting: %w", err)
+		return nil, fmt.Errorf("failed to predict %s at target latency: %w", strings.ToLower(results[0].LoadName()), err)
 	}
 
-	// Generate prediction points for the quadratic fit
+	// Generate prediction points for the fit
 	numPredictionPoints := 100
-	quadFitPts := make(plotter.XYs, numPredictionPoints)
-	maxConcurrency := performancePts[len(performancePts)-1].X
+	fitPts := make(plotter.XYs, numPredictionPoints)
 
 	for i := 0; i < numPredictionPoints; i++ {
 		x := maxConcurrency * float64(i) / float64(numPredictionPoints-1)
-		y := a*x*x + b*x + c
-		quadFitPts[i].X = x
-		quadFitPts[i].Y = y
-	}
-
-	// Predict the concurrency at the target latency
-	predictedConcurrency, err := predictConcurrencyQuad(a, b, c, targetLatency)
-	if err != nil {
-		return fmt.Errorf("failed to predict concurrency at target latency: %w", err)
+		y := model.Predict(x)
+		fitPts[i].X = x
+		fitPts[i].Y = y
 	}
 
 	// Plot the full Latency vs. Concurrency
 	latencyPlot := plot.New()
-	latencyPlot.Title.Text = "Latency vs. Concurrency"
-	latencyPlot.X.Label.Text = "Concurrency"
+	loadName := results[0].LoadName()
+	latencyPlot.Title.Text = "Latency vs. " + loadName
+	latencyPlot.X.Label.Text = loadName
 	latencyPlot.Y.Label.Text = "Latency (ms)"
 
 	// Add original data points
 	dataLine, err := plotter.NewScatter(performancePts)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	dataLine.GlyphStyle.Shape = draw.CircleGlyph{}
 
-	// Add quadratic fit line
-	quadLine, err := plotter.NewLine(quadFitPts)
+	// Add model fit line
+	fitLine, err := plotter.NewLine(fitPts)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	quadLine.LineStyle.Width = vg.Points(2)
-	quadLine.Color = color.RGBA{R: 255, G: 0, B: 0, A: 255}
+	fitLine.LineStyle.Width = vg.Points(2)
+	fitLine.Color = color.RGBA{R: 255, G: 0, B: 0, A: 255}
 
-	latencyPlot.Add(dataLine, quadLine)
+	latencyPlot.Add(dataLine, fitLine)
 	latencyPlot.Legend.Add("Data Points", dataLine)
-	latencyPlot.Legend.Add("Quadratic Fit", quadLine)
+	latencyPlot.Legend.Add(fitName, fitLine)
+
+	// Mark the steps left out of the fit and the check
+	if len(excludedPts) > 0 {
+		excludedLine, err := plotter.NewScatter(excludedPts)
+		if err != nil {
+			return nil, err
+		}
+		excludedLine.GlyphStyle.Shape = draw.CrossGlyph{}
+		excludedLine.GlyphStyle.Color = color.Gray{Y: 128}
+		latencyPlot.Add(excludedLine)
+		latencyPlot.Legend.Add("Excluded (error rate)", excludedLine)
+	}
+	var checkPoint *plotter.Scatter
+	if check != nil {
+		checkPoint, err = plotter.NewScatter(plotter.XYs{{X: check.Load(), Y: check.Latency(latencyPercentile)}})
+		if err != nil {
+			return nil, err
+		}
+		checkPoint.GlyphStyle.Shape = draw.TriangleGlyph{}
+		checkPoint.GlyphStyle.Color = color.RGBA{B: 255, A: 255}
+		latencyPlot.Add(checkPoint)
+		latencyPlot.Legend.Add("Check", checkPoint)
+	}
 
 	// Save the full latency plot
 	if err := latencyPlot.Save(6*vg.Inch, 4*vg.Inch, "latency_with_fit.png"); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Plot the zoomed Latency vs. Concurrency
 	zoomedPlot := plot.New()
-	zoomedPlot.Title.Text = "Zoomed: Latency vs. Concurrency"
-	zoomedPlot.X.Label.Text = "Concurrency"
+	zoomedPlot.Title.Text = "Zoomed: Latency vs. " + loadName
+	zoomedPlot.X.Label.Text = loadName
 	zoomedPlot.Y.Label.Text = "Latency (ms)"
 
 	xMin := predictedConcurrency * 0.9
@@ -232,11 +458,11 @@ func plotResults(results []*TestResult, targetLatency int, latencyPercentile Lat
 
 	targetPoint, err := plotter.NewScatter(plotter.XYs{{X: predictedConcurrency, Y: float64(targetLatency)}})
 	if err != nil {
-		return err
+		return nil, err
 	}
 	targetPoint.GlyphStyle.Shape = draw.CircleGlyph{}
 
-	// Generate prediction points for the quadratic fit
+	// Generate prediction points for the model fit
 	predictedFitPts := make(plotter.XYs, numPredictionPoints)
 	// Calculate the step size based on xMin and xMax
 	step := (xMax - xMin) / float64(numPredictionPoints-1)
@@ -244,17 +470,17 @@ func plotResults(results []*TestResult, targetLatency int, latencyPercentile Lat
 		// Start directly at xMin and increment by the step
 		x := xMin + step*float64(i)
 
-		// Compute y using the quadratic equation
-		y := a*x*x + b*x + c
+		// Compute y using the fitted model
+		y := model.Predict(x)
 
 		// Add the point to the slice
 		predictedFitPts[i] = plotter.XY{X: x, Y: y}
 	}
 
-	// Add quadratic fit line
+	// Add model fit line
 	predictedLine, err := plotter.NewLine(predictedFitPts)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	predictedLine.LineStyle.Width = vg.Points(2)
 	predictedLine.Color = color.RGBA{R: 255, G: 0, B: 0, A: 255}
@@ -262,30 +488,59 @@ func plotResults(results []*TestResult, targetLatency int, latencyPercentile Lat
 	// Add the same data and fit lines
 	zoomedPlot.Add(targetPoint, predictedLine)
 	zoomedPlot.Legend.Add("Data Points", dataLine)
-	zoomedPlot.Legend.Add("Quadratic Fit", predictedLine)
+	zoomedPlot.Legend.Add(fitName, predictedLine)
+	if checkPoint != nil {
+		zoomedPlot.Add(checkPoint)
+		zoomedPlot.Legend.Add("Check", checkPoint)
+	}
 
 	// Save the zoomed latency plot
 	if err := zoomedPlot.Save(6*vg.Inch, 4*vg.Inch, "latency_with_fit_zoomed.png"); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Plot RPS vs. Concurrency
 	rpsPlot := plot.New()
-	rpsPlot.Title.Text = "RPS vs. Concurrency"
-	rpsPlot.X.Label.Text = "Concurrency"
+	rpsPlot.Title.Text = "RPS vs. " + loadName
+	rpsPlot.X.Label.Text = loadName
 	rpsPlot.Y.Label.Text = "RPS"
 	rpsLine, err := plotter.NewLine(rpsPts)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	rpsPlot.Add(rpsLine)
 	rpsPlot.Legend.Add("RPS Data", rpsLine)
+	if check != nil {
+		checkRPS, err := plotter.NewScatter(plotter.XYs{{X: check.Load(), Y: check.Throughput}})
+		if err != nil {
+			return nil, err
+		}
+		checkRPS.GlyphStyle = checkPoint.GlyphStyle
+		rpsPlot.Add(checkRPS)
+		rpsPlot.Legend.Add("Check", checkRPS)
+	}
+
+	// Add the throughput fit for models that have one
+	if throughputModel, ok := model.(ThroughputModel); ok {
+		throughputPts := make(plotter.XYs, numPredictionPoints)
+		for i := range throughputPts {
+			x := maxConcurrency * float64(i) / float64(numPredictionPoints-1)
+			throughputPts[i] = plotter.XY{X: x, Y: throughputModel.Throughput(x)}
+		}
+		throughputLine, err := plotter.NewLine(throughputPts)
+		if err != nil {
+			return nil, err
+		}
+		throughputLine.LineStyle.Width = vg.Points(2)
+		throughputLine.Color = color.RGBA{R: 255, G: 0, B: 0, A: 255}
+		rpsPlot.Add(throughputLine)
+		rpsPlot.Legend.Add(fitName, throughputLine)
+	}
 
 	// Save the RPS plot
 	if err := rpsPlot.Save(6*vg.Inch, 4*vg.Inch, "rps.png"); err != nil {
-		return err
+		return nil, err
 	}
 
-	fmt.Println("Plots generated: latency_with_fit.png, latency_with_fit_zoomed.png, and rps.png")
-	return nil
+	return []string{"latency_with_fit.png", "latency_with_fit_zoomed.png", "rps.png"}, nil
 }
@@ -0,0 +1,89 @@
+package loadtest
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+// fakeGenerator serves latency = 10 + c²/100 ms at concurrency c, with the
+// throughput Little's law gives for it.
+type fakeGenerator struct {
+	warmups int
+	runs    []int
+}
+
+func (g *fakeGenerator) Warmup() error {
+	g.warmups++
+	return nil
+}
+
+func (g *fakeGenerator) Run(concurrency, duration int) (*TestResult, error) {
+	g.runs = append(g.runs, concurrency)
+	latency := 10 + float64(concurrency*concurrency)/100
+	throughput := float64(concurrency) / latency * 1000
+	completed := int(throughput * float64(duration))
+	return &TestResult{
+		Throughput:  throughput,
+		AvgLatency:  latency,
+		Connections: concurrency,
+		Duration:    float64(duration),
+		Completed:   completed,
+		Successful:  completed,
+		MinLatency:  latency / 2,
+		MaxLatency:  latency * 2,
+		Latency50:   latency,
+		Latency90:   latency,
+		Latency98:   latency,
+		Latency99:   latency,
+	}, nil
+}
+
+func TestRunnerRun(t *testing.T) {
+	generator := &fakeGenerator{}
+	runner := NewRunner(generator, 1, 60, Latency90, []int{10, 20, 40, 60, 80, 100}, true, false)
+	runner.Model = ModelQuadratic
+	runner.BootstrapSamples = 0
+	runner.Progress = nil
+
+	report, err := runner.Run()
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if generator.warmups != 1 {
+		t.Errorf("warmups = %d, want 1", generator.warmups)
+	}
+	if len(report.Results) != 6 {
+		t.Errorf("got %d results, want 6", len(report.Results))
+	}
+	if report.Prediction == nil {
+		t.Fatalf("no prediction: %s", report.Error)
+	}
+	if want := math.Sqrt(5000); math.Abs(report.Prediction.Load-want) > 0.01 {
+		t.Errorf("predicted concurrency %.3f, want %.3f", report.Prediction.Load, want)
+	}
+	if report.Check == nil || report.Check.Connections != int(math.Round(report.Prediction.Load)) {
+		t.Errorf("check did not run at the predicted concurrency: %+v", report.Check)
+	}
+	if want := []int{10, 20, 40, 60, 80, 100, 71}; !slices.Equal(generator.runs, want) {
+		t.Errorf("ran %v, want %v", generator.runs, want)
+	}
+}
+
+func TestRunnerRunFewSteps(t *testing.T) {
+	// Three steps leave no model enough data points to rank by AIC
+	runner := NewRunner(&fakeGenerator{}, 1, 60, Latency90, []int{1, 10, 100}, false, false)
+	runner.BootstrapSamples = 0
+	runner.Progress = nil
+
+	report, err := runner.Run()
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if report.Model.Name() != ModelQuadratic {
+		t.Errorf("selected %s, want quadratic", report.Model.Name())
+	}
+	if want := math.Sqrt(5000); math.Abs(report.Prediction.Load-want) > 0.01 {
+		t.Errorf("predicted concurrency %.3f, want %.3f", report.Prediction.Load, want)
+	}
+}
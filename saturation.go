@@ -0,0 +1,88 @@
+package loadtest
+
+// saturationPoint returns the first step after which throughput stops
+// scaling: where the marginal RPS gained per unit of added load drops below
+// threshold times the RPS per unit of load at the first step. It returns
+// false if throughput scales across every step.
+func saturationPoint(steps []*StepStats, threshold float64) (float64, float64, bool) {
+	if len(steps) < 2 || steps[0].Load <= 0 {
+		return 0, 0, false
+	}
+	baseline := steps[0].MeanThroughput / steps[0].Load
+	for i := 1; i < len(steps); i++ {
+		previous, step := steps[i-1], steps[i]
+		marginal := (step.MeanThroughput - previous.MeanThroughput) / (step.Load - previous.Load)
+		if marginal < threshold*baseline {
+			return previous.Load, previous.MeanThroughput, true
+		}
+	}
+	return 0, 0, false
+}
+
+// kneedle finds the knee of an increasing convex curve with the Kneedle
+// algorithm: with both axes normalized to [0, 1], the knee is the point
+// furthest below the line from the first to the last point. It returns the
+// index of the knee, or false if the curve has none.
+func kneedle(xs, ys []float64) (int, bool) {
+	n := len(xs)
+	if n < 3 {
+		return 0, false
+	}
+	minY, maxY := ys[0], ys[0]
+	for _, y := range ys {
+		minY = min(minY, y)
+		maxY = max(maxY, y)
+	}
+	if xs[n-1] == xs[0] || maxY == minY {
+		return 0, false
+	}
+
+	knee, best := 0, 0.0
+	for i := range xs {
+		x := (xs[i] - xs[0]) / (xs[n-1] - xs[0])
+		y := (ys[i] - minY) / (maxY - minY)
+		if difference := x - y; difference > best {
+			knee, best = i, difference
+		}
+	}
+	return knee, best > 0
+}
+
+// latencyKnee finds the knee of latency vs. load, on the fitted model's curve
+// when there is one and on the step means otherwise.
+func latencyKnee(steps []*StepStats, model Model) (float64, float64, bool) {
+	if len(steps) < 3 {
+		return 0, 0, false
+	}
+	xs, ys := []float64{}, []float64{}
+	if model != nil {
+		const points = 100
+		first, last := steps[0].Load, steps[len(steps)-1].Load
+		for i := 0; i < points; i++ {
+			x := first + (last-first)*float64(i)/(points-1)
+			xs = append(xs, x)
+			ys = append(ys, model.Predict(x))
+		}
+	} else {
+		for _, step := range steps {
+			xs = append(xs, step.Load)
+			ys = append(ys, step.MeanLatency)
+		}
+	}
+	knee, ok := kneedle(xs, ys)
+	if !ok {
+		return 0, 0, false
+	}
+	return xs[knee], ys[knee], true
+}
+
+// analyzeSaturation fills in the saturation point and latency knee of the
+// prediction.
+func (r *Runner) analyzeSaturation(prediction *Prediction, steps []*StepStats, model Model) {
+	if load, rps, ok := saturationPoint(steps, r.SaturationThreshold); ok {
+		prediction.SaturationLoad, prediction.SaturationRPS = load, rps
+	}
+	if load, latency, ok := latencyKnee(steps, model); ok {
+		prediction.KneeLoad, prediction.KneeLatency = load, latency
+	}
+}
@@ -0,0 +1,138 @@
+package loadtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LoadResults reads previously saved results for offline analysis, sorted by
+// load. Each path may be a JSON report written with -output json, a single
+// result saved with -histograms, a directory of such results, or a file of
+// raw apib CSV lines, one result per line. Checks saved to a directory are
+// skipped, as they are not part of the tested steps.
+func LoadResults(paths ...string) ([]*TestResult, error) {
+	results := []*TestResult{}
+	for _, path := range paths {
+		loaded, err := loadResultPath(path)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, loaded...)
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no results found in %s", strings.Join(paths, ", "))
+	}
+	for _, res := range results {
+		if res.LoadName() != results[0].LoadName() {
+			return nil, fmt.Errorf("cannot analyze concurrency and rate results together")
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Load() < results[j].Load() })
+	return results, nil
+}
+
+func loadResultPath(path string) ([]*TestResult, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read results: %w", err)
+	}
+	if !info.IsDir() {
+		return loadResultFile(path)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read results: %w", err)
+	}
+	results := []*TestResult{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".json" || strings.HasPrefix(name, "check-") {
+			continue
+		}
+		loaded, err := loadResultFile(filepath.Join(path, name))
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, loaded...)
+	}
+	return results, nil
+}
+
+func loadResultFile(path string) ([]*TestResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read results: %w", err)
+	}
+	var results []*TestResult
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		results, err = parseJSONResults(data)
+	} else {
+		results, err = parseCSVResults(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read results from %s: %w", path, err)
+	}
+	return results, nil
+}
+
+// parseJSONResults reads the results of a JSON report, or a single result
+func parseJSONResults(data []byte) ([]*TestResult, error) {
+	var doc struct {
+		SchemaVersion int           `json:"schema_version"`
+		Results       []*TestResult `json:"results"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("unsupported schema version %d, this version reads up to %d", doc.SchemaVersion, SchemaVersion)
+	}
+	if doc.SchemaVersion > 0 {
+		return doc.Results, nil
+	}
+
+	res := &TestResult{}
+	if err := json.Unmarshal(data, res); err != nil {
+		return nil, err
+	}
+	if res.Load() <= 0 {
+		return nil, fmt.Errorf("not a saved result or report: no concurrency or rate recorded")
+	}
+	return []*TestResult{res}, nil
+}
+
+// parseCSVResults reads one result per line of apib CSV output, skipping
+// blank lines and a header row if there is one.
+func parseCSVResults(data []byte) ([]*TestResult, error) {
+	results := []*TestResult{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if line == 1 && strings.HasPrefix(strings.ToLower(text), "schema_version,") {
+			return nil, fmt.Errorf("CSV reports cannot be analyzed, write the report with -output json instead")
+		}
+		if line == 1 && strings.HasPrefix(strings.ToLower(text), "name,") {
+			continue
+		}
+		res, err := parseCSVOutput(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		results = append(results, res)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
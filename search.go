@@ -0,0 +1,126 @@
+package loadtest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// SearchResult is the outcome of Runner.Search
+type SearchResult struct {
+	// MaxConcurrency is the highest concurrency measured to meet the target
+	// latency and error rate limit, or 0 if none did.
+	MaxConcurrency int
+	// Report holds every step of the search, sorted by concurrency, and the
+	// regression over them. Its Prediction is nil if the analysis failed.
+	Report *Report
+}
+
+// Search finds the highest concurrency that meets TargetLatency and
+// MaxErrorRate by measurement rather than extrapolation. Starting at
+// SearchStart it grows the concurrency by SearchFactor until the latency
+// percentile exceeds TargetLatency or the error rate exceeds MaxErrorRate (or
+// SearchMax is reached), then bisects between the last passing and first
+// failing concurrency until they are within SearchTolerance. If plotting the
+// report fails, the result is returned along with the error.
+func (r *Runner) Search() (*SearchResult, error) {
+	if len(r.RateSteps) > 0 {
+		return nil, fmt.Errorf("search is only supported for concurrency tests")
+	}
+	start := max(r.SearchStart, 1)
+	factor := r.SearchFactor
+	if factor <= 1 {
+		return nil, fmt.Errorf("search factor must be greater than 1, got %g", factor)
+	}
+	tolerance := max(r.SearchTolerance, 1)
+
+	// Warmup request
+	if err := r.Generator.Warmup(); err != nil {
+		return nil, fmt.Errorf("warmup failed: %w", err)
+	}
+
+	started := time.Now()
+	results := []*TestResult{}
+	measure := func(concurrency int) (bool, error) {
+		trials, err := r.measureTrials(float64(concurrency))
+		if err != nil {
+			return false, err
+		}
+		if len(trials) == 0 {
+			return false, fmt.Errorf("every trial failed at concurrency %d", concurrency)
+		}
+		results = append(results, trials...)
+		selected, err := endpointResults(trials, r.Endpoint)
+		if err != nil {
+			return false, err
+		}
+		// Repeated trials pass on their mean latency and error rate
+		step := stepStatistics(selected, r.LatencyPercentile, r.MaxCV)[0]
+		return step.MeanLatency <= float64(r.TargetLatency) && step.MeanErrorRate <= r.MaxErrorRate, nil
+	}
+
+	// Grow geometrically until the target latency is exceeded
+	passing, failing := 0, 0
+	for concurrency := start; ; {
+		ok, err := measure(concurrency)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			failing = concurrency
+			break
+		}
+		passing = concurrency
+		if r.SearchMax > 0 && concurrency >= r.SearchMax {
+			r.printf("Reached maximum search concurrency %d without exceeding %dms\n", r.SearchMax, r.TargetLatency)
+			break
+		}
+		next := max(int(math.Ceil(float64(concurrency)*factor)), concurrency+1)
+		if r.SearchMax > 0 {
+			next = min(next, r.SearchMax)
+		}
+		concurrency = next
+	}
+
+	// Bisect between the last passing and first failing concurrency
+	for failing > 0 && failing-passing > tolerance {
+		concurrency := (passing + failing) / 2
+		if concurrency == passing {
+			break
+		}
+		ok, err := measure(concurrency)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			passing = concurrency
+		} else {
+			failing = concurrency
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Load() < results[j].Load() })
+	search := &SearchResult{MaxConcurrency: passing}
+	tested := time.Since(started)
+
+	// Compare the measurement with the regression over all steps
+	report, err := r.Analyze(results)
+	report.Started, report.TestDuration = started, tested
+	report.MaxConcurrency = passing
+	search.Report = report
+	if err != nil {
+		report.warnf("could not predict concurrency from search results: %v", err)
+	}
+	if passing == 0 {
+		report.warnf("target latency of %dms was not met even at concurrency %d", r.TargetLatency, start)
+	}
+
+	if r.Plot {
+		if err := r.PlotReport(report); err != nil {
+			return search, err
+		}
+	}
+
+	return search, nil
+}
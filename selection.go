@@ -0,0 +1,164 @@
+package loadtest
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+)
+
+// ModelAuto fits every model in ModelTypes and predicts with the one that
+// fits best, see selectModel.
+const ModelAuto ModelType = "auto"
+
+// ModelFit is a fitted model with its goodness of fit and prediction over the
+// same observations.
+type ModelFit struct {
+	Model Model
+	// R2 is the coefficient of determination of the latency fit
+	R2 float64
+	// RMSE is the root mean squared latency error (ms)
+	RMSE float64
+	// AIC and BIC are the Akaike and Bayesian information criteria, which
+	// penalize the squared error by the number of parameters
+	AIC float64
+	BIC float64
+	// Prediction is the load at the target latency
+	Prediction float64
+	// Err is set when the model could not be fitted or gave no valid
+	// prediction.
+	Err error
+}
+
+// goodnessOfFit computes R², RMSE, AIC and BIC of a fitted model, weighting
+// every observation as the fit did
+func goodnessOfFit(model Model, observations []Observation) (r2, rmse, aic, bic float64) {
+	n := float64(len(observations))
+	mean, total := 0.0, 0.0
+	for _, o := range observations {
+		mean += weightOf(o.Weight) * o.Latency
+		total += weightOf(o.Weight)
+	}
+	mean /= total
+
+	sse, sst := 0.0, 0.0
+	for _, o := range observations {
+		residual := o.Latency - model.Predict(o.Load)
+		sse += weightOf(o.Weight) * residual * residual
+		sst += weightOf(o.Weight) * (o.Latency - mean) * (o.Latency - mean)
+	}
+
+	r2 = 1 - sse/sst
+	rmse = math.Sqrt(sse / total)
+	k := float64(model.NumParams())
+	// Gaussian log-likelihood up to a constant; guard against perfect fits
+	logLikelihood := n * math.Log(math.Max(sse/total, 1e-12))
+	aic = logLikelihood + 2*k
+	bic = logLikelihood + k*math.Log(n)
+	return r2, rmse, aic, bic
+}
+
+// compareModels fits every model in ModelTypes to the results and predicts
+// the load at targetLatency with each.
+func compareModels(targetLatency int, latencyPercentile LatencyPercentile, results []*TestResult, bandwidth float64) ([]*ModelFit, error) {
+	observations, err := observationsFor(results, latencyPercentile, targetLatency, bandwidth)
+	if err != nil {
+		return nil, err
+	}
+
+	fits := []*ModelFit{}
+	for _, modelType := range ModelTypes {
+		fit := &ModelFit{}
+		fits = append(fits, fit)
+
+		fit.Model, fit.Err = fitModel(modelType, results, latencyPercentile, targetLatency, bandwidth)
+		if fit.Err != nil {
+			fit.Model, _ = NewModel(modelType)
+			continue
+		}
+		fit.R2, fit.RMSE, fit.AIC, fit.BIC = goodnessOfFit(fit.Model, observations)
+		// Without residual degrees of freedom any model fits perfectly, so
+		// the information criteria can't rank it
+		if len(observations) <= fit.Model.NumParams()+1 {
+			fit.AIC, fit.BIC = math.NaN(), math.NaN()
+		}
+
+		fit.Prediction, fit.Err = fit.Model.Solve(float64(targetLatency))
+		if fit.Err == nil {
+			fit.Err = validatePrediction(fit.Prediction, targetLatency, latencyPercentile, results)
+		}
+	}
+	return fits, nil
+}
+
+// selectModel picks the model with the lowest AIC among those with a valid
+// prediction, and explains the choice. When there are too few observations to
+// rank any of them by AIC, the quadratic model is preferred, or else the first
+// valid one.
+func selectModel(fits []*ModelFit) (*ModelFit, string, error) {
+	valid := []*ModelFit{}
+	for _, fit := range fits {
+		if fit.Err == nil {
+			valid = append(valid, fit)
+		}
+	}
+	if len(valid) == 0 {
+		return nil, "", fmt.Errorf("no model gave a valid prediction")
+	}
+
+	ranked := []*ModelFit{}
+	for _, fit := range valid {
+		if !math.IsNaN(fit.AIC) {
+			ranked = append(ranked, fit)
+		}
+	}
+	if len(ranked) == 0 {
+		best := valid[0]
+		for _, fit := range valid {
+			if fit.Model.Name() == ModelQuadratic {
+				best = fit
+			}
+		}
+		return best, fmt.Sprintf("too few data points to rank the %d models with a valid prediction by AIC", len(valid)), nil
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].AIC < ranked[j].AIC })
+	best := ranked[0]
+	reason := fmt.Sprintf("lowest AIC (%.2f) of %d models with a valid prediction", best.AIC, len(ranked))
+	if len(ranked) < len(valid) {
+		reason += fmt.Sprintf(" and enough data points to rank (%d without)", len(valid)-len(ranked))
+	}
+	if len(ranked) > 1 {
+		reason += fmt.Sprintf(", next best %s by ΔAIC %.2f", ranked[1].Model.Name(), ranked[1].AIC-best.AIC)
+	}
+	return best, reason, nil
+}
+
+// writeModelComparison prints a table of every model's goodness of fit
+func writeModelComparison(w io.Writer, fits []*ModelFit, loadName string) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Model\tParams\tR²\tRMSE (ms)\tAIC\tBIC\tCond\tPredicted %s\n", loadName)
+	for _, fit := range fits {
+		name := fit.Model.Name()
+		params := fit.Model.NumParams()
+		if fit.Err != nil && fit.RMSE == 0 {
+			fmt.Fprintf(tw, "%s\t%d\t-\t-\t-\t-\t-\terror: %v\n", name, params, fit.Err)
+			continue
+		}
+		cond := "-"
+		if conditioned, ok := fit.Model.(ConditionedModel); ok {
+			cond = fmt.Sprintf("%.3g", conditioned.ConditionNumber())
+		}
+		prediction := fmt.Sprintf("%.2f", fit.Prediction)
+		if fit.Err != nil {
+			prediction = fmt.Sprintf("invalid: %v", fit.Err)
+		}
+		aic, bic := "-", "-"
+		if !math.IsNaN(fit.AIC) {
+			aic, bic = fmt.Sprintf("%.2f", fit.AIC), fmt.Sprintf("%.2f", fit.BIC)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%.4f\t%.2f\t%s\t%s\t%s\t%s\n", name, params, fit.R2, fit.RMSE, aic, bic, cond, prediction)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,178 @@
+package loadtest
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// TemplateSource renders the requests drawn from Source as text/templates:
+// the URL, header values and body are executed against the next row of
+// Feeder, e.g. "/items/{{.id}}". Text values are percent-encoded in the URL,
+// so they can hold spaces, slashes, & or ?, and are inserted as is in header
+// values and the body. Labels are left as is, so per-endpoint results group
+// by the template rather than by every rendered URL.
+type TemplateSource struct {
+	Source RequestSource
+	Feeder *Feeder
+
+	templates sync.Map // *Request -> *requestTemplate
+}
+
+func NewTemplateSource(source RequestSource, feeder *Feeder) *TemplateSource {
+	return &TemplateSource{Source: source, Feeder: feeder}
+}
+
+func (s *TemplateSource) NewUser(id int) RequestIterator {
+	return &templateIterator{source: s, user: s.Source.NewUser(id)}
+}
+
+type templateIterator struct {
+	source *TemplateSource
+	user   RequestIterator
+}
+
+func (it *templateIterator) Next() (*Request, error) {
+	req, err := it.user.Next()
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := it.source.template(req)
+	if err != nil {
+		return nil, err
+	}
+	row, err := it.source.Feeder.Next()
+	if err != nil {
+		return nil, err
+	}
+	return tmpl.render(row)
+}
+
+// WarmupRequest renders the first request with a sample row, leaving the
+// Feeder's rows for the test
+func (s *TemplateSource) WarmupRequest() (*Request, error) {
+	req, err := s.Source.NewUser(0).Next()
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := s.template(req)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl.render(s.Feeder.Sample())
+}
+
+// template returns the compiled templates for req, parsing them on first use
+func (s *TemplateSource) template(req *Request) (*requestTemplate, error) {
+	if tmpl, ok := s.templates.Load(req); ok {
+		return tmpl.(*requestTemplate), nil
+	}
+	tmpl, err := newRequestTemplate(req)
+	if err != nil {
+		return nil, err
+	}
+	s.templates.Store(req, tmpl)
+	return tmpl, nil
+}
+
+type requestTemplate struct {
+	request *Request
+	url     *template.Template
+	header  map[string][]*template.Template
+	body    *template.Template
+}
+
+func newRequestTemplate(req *Request) (*requestTemplate, error) {
+	parse := func(name, text string) (*template.Template, error) {
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request template: %w", err)
+		}
+		return tmpl, nil
+	}
+
+	tmpl := &requestTemplate{request: req, header: map[string][]*template.Template{}}
+	var err error
+	if tmpl.url, err = parse("url", req.URL); err != nil {
+		return nil, err
+	}
+	for name, values := range req.Header {
+		for _, value := range values {
+			t, err := parse(name, value)
+			if err != nil {
+				return nil, err
+			}
+			tmpl.header[name] = append(tmpl.header[name], t)
+		}
+	}
+	if len(req.Body) > 0 {
+		if tmpl.body, err = parse("body", string(req.Body)); err != nil {
+			return nil, err
+		}
+	}
+	return tmpl, nil
+}
+
+func (t *requestTemplate) render(row map[string]any) (*Request, error) {
+	execute := func(tmpl *template.Template, data any) (string, error) {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return "", fmt.Errorf("failed to render request template: %w", err)
+		}
+		return buf.String(), nil
+	}
+
+	url, err := execute(t.url, escapeURLValues(row))
+	if err != nil {
+		return nil, err
+	}
+	req := &Request{
+		Label:  t.request.Label,
+		Method: t.request.Method,
+		URL:    url,
+		Header: http.Header{},
+	}
+	for name, templates := range t.header {
+		for _, tmpl := range templates {
+			value, err := execute(tmpl, row)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Add(name, value)
+		}
+	}
+	if t.body != nil {
+		body, err := execute(t.body, row)
+		if err != nil {
+			return nil, err
+		}
+		req.Body = []byte(body)
+	}
+	return req, nil
+}
+
+// escapeURLValues returns a copy of value with every string, including those
+// nested in objects and lists, percent-encoded for any part of a URL
+func escapeURLValues(value any) any {
+	switch v := value.(type) {
+	case string:
+		return strings.ReplaceAll(url.QueryEscape(v), "+", "%20")
+	case map[string]any:
+		escaped := make(map[string]any, len(v))
+		for key, value := range v {
+			escaped[key] = escapeURLValues(value)
+		}
+		return escaped
+	case []any:
+		escaped := make([]any, len(v))
+		for i, value := range v {
+			escaped[i] = escapeURLValues(value)
+		}
+		return escaped
+	}
+	return value
+}
@@ -0,0 +1,77 @@
+package loadtest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTemplateSource(t *testing.T) {
+	request := NewRequest("http://api.example/items/{{.id}}?q={{.query}}&tag={{index .tags 0}}")
+	request.Method = "POST"
+	request.Label = "items"
+	request.Header.Set("X-Query", "{{.query}}")
+	request.Body = []byte(`{"id": {{.id}}, "query": "{{.query}}"}`)
+	rows := []map[string]any{
+		{"id": 1.0, "query": "a b&c=d/e?", "tags": []any{"x y"}},
+		{"id": "2/3", "query": "plain", "tags": []any{"z"}},
+	}
+	source := NewTemplateSource(request, &Feeder{Rows: rows, Mode: FeedUnique})
+
+	for _, want := range []struct {
+		url, header, body string
+	}{
+		{"http://api.example/items/1?q=a%20b%26c%3Dd%2Fe%3F&tag=x%20y", "a b&c=d/e?", `{"id": 1, "query": "a b&c=d/e?"}`},
+		{"http://api.example/items/2%2F3?q=plain&tag=z", "plain", `{"id": 2/3, "query": "plain"}`},
+	} {
+		req, err := source.NewUser(0).Next()
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if req.URL != want.url || req.Header.Get("X-Query") != want.header || string(req.Body) != want.body {
+			t.Errorf("rendered %s %q %s, want %s %q %s", req.URL, req.Header.Get("X-Query"), req.Body, want.url, want.header, want.body)
+		}
+		if req.Method != "POST" || req.Label != "items" {
+			t.Errorf("rendered %s %q, want the template's method and label", req.Method, req.Label)
+		}
+	}
+
+	// The rows are used up, but the warmup never draws one
+	if _, err := source.NewUser(1).Next(); !errors.Is(err, ErrSourceExhausted) {
+		t.Errorf("Next after the last row: got %v, want ErrSourceExhausted", err)
+	}
+	warmup, err := source.WarmupRequest()
+	if err != nil {
+		t.Fatalf("WarmupRequest: %v", err)
+	}
+	if !strings.HasPrefix(warmup.URL, "http://api.example/items/1?") {
+		t.Errorf("warmup URL %s, want the first row rendered", warmup.URL)
+	}
+}
+
+func TestTemplateSourceWarmup(t *testing.T) {
+	feeder := &Feeder{Rows: []map[string]any{{"id": "a"}, {"id": "b"}}, Mode: FeedUnique}
+	source := NewTemplateSource(NewRequest("http://api.example/{{.id}}"), feeder)
+	if _, err := source.WarmupRequest(); err != nil {
+		t.Fatalf("WarmupRequest: %v", err)
+	}
+	req, err := source.NewUser(0).Next()
+	if err != nil || req.URL != "http://api.example/a" {
+		t.Errorf("first request after the warmup = %v, %v, want the first row", req, err)
+	}
+}
+
+func TestTemplateSourceErrors(t *testing.T) {
+	feeder := &Feeder{Rows: []map[string]any{{"id": 1}}, Mode: FeedSequential}
+	for _, test := range []struct {
+		url, want string
+	}{
+		{"http://api.example/{{.id", "invalid request template"},
+		{"http://api.example/{{.missing}}", "failed to render request template"},
+	} {
+		_, err := NewTemplateSource(NewRequest(test.url), feeder).NewUser(0).Next()
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got %v, want an error containing %q", test.url, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package loadtest
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"text/tabwriter"
+)
+
+// StepStats summarizes the repeated trials of a single load level
+type StepStats struct {
+	Load   float64       `json:"load"`
+	Trials []*TestResult `json:"-"`
+	// MeanLatency and LatencyStdDev are over the latency percentile being
+	// predicted on, LatencyCV is their ratio.
+	MeanLatency   float64 `json:"mean_latency_ms"`
+	LatencyStdDev float64 `json:"latency_stddev_ms"`
+	LatencyCV     float64 `json:"latency_cv"`
+	// MeanThroughput and ThroughputStdDev are in RPS
+	MeanThroughput   float64 `json:"mean_throughput_rps"`
+	ThroughputStdDev float64 `json:"throughput_stddev_rps"`
+	// MeanErrorRate is the mean fraction of failed and non-2xx requests
+	MeanErrorRate float64 `json:"mean_error_rate"`
+	// Unstable is set when LatencyCV exceeds the runner's MaxCV
+	Unstable bool `json:"unstable"`
+}
+
+// stepStatistics groups consecutive results with the same load into steps
+// and computes the mean, standard deviation and coefficient of variation of
+// each.
+func stepStatistics(results []*TestResult, latencyPercentile LatencyPercentile, maxCV float64) []*StepStats {
+	steps := []*StepStats{}
+	for _, res := range results {
+		if len(steps) == 0 || steps[len(steps)-1].Load != res.Load() {
+			steps = append(steps, &StepStats{Load: res.Load()})
+		}
+		step := steps[len(steps)-1]
+		step.Trials = append(step.Trials, res)
+	}
+
+	for _, step := range steps {
+		latencies := make([]float64, len(step.Trials))
+		throughputs := make([]float64, len(step.Trials))
+		for i, res := range step.Trials {
+			latencies[i] = res.Latency(latencyPercentile)
+			throughputs[i] = res.Throughput
+			step.MeanErrorRate += res.ErrorRate() / float64(len(step.Trials))
+		}
+		step.MeanLatency, step.LatencyStdDev = meanStdDev(latencies)
+		step.MeanThroughput, step.ThroughputStdDev = meanStdDev(throughputs)
+		if step.MeanLatency > 0 {
+			step.LatencyCV = step.LatencyStdDev / step.MeanLatency
+		}
+		step.Unstable = maxCV > 0 && step.LatencyCV > maxCV
+	}
+	return steps
+}
+
+// meanStdDev returns the mean and sample standard deviation of values
+func meanStdDev(values []float64) (float64, float64) {
+	mean := 0.0
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	if len(values) < 2 {
+		return mean, 0
+	}
+
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(values)-1))
+}
+
+// writeStepStatistics prints a table of every step's trial statistics
+func writeStepStatistics(w io.Writer, steps []*StepStats, loadName string, latencyPercentile LatencyPercentile) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\tTrials\t%s Latency (ms)\tStdDev\tCV\tRPS\tStdDev\t\n", loadName, latencyPercentile)
+	for _, step := range steps {
+		flag := ""
+		if step.Unstable {
+			flag = "unstable"
+		}
+		fmt.Fprintf(tw, "%g\t%d\t%.2f\t%.2f\t%.1f%%\t%.2f\t%.2f\t%s\n", step.Load, len(step.Trials), step.MeanLatency, step.LatencyStdDev, step.LatencyCV*100, step.MeanThroughput, step.ThroughputStdDev, flag)
+	}
+	tw.Flush()
+}
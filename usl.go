@@ -0,0 +1,169 @@
+package loadtest
+
+import (
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/optimize"
+)
+
+// USLModel is a fit of the Universal Scalability Law to throughput vs.
+// concurrency:
+//
+//	X(N) = λN / (1 + σ(N-1) + κN(N-1))
+//
+// where λ is the throughput of a single connection, σ the contention (serial
+// fraction) and κ the coherency (crosstalk) penalty. Latency follows from
+// Little's law as N/X(N), scaled by the average ratio of the chosen percentile
+// to the mean latency across the observations.
+type USLModel struct {
+	Lambda float64
+	Sigma  float64
+	Kappa  float64
+
+	// LatencyScale converts mean latency to the fitted percentile
+	LatencyScale float64
+}
+
+func (u *USLModel) Name() ModelType { return ModelUSL }
+
+// NumParams counts λ, σ, κ and the latency scale
+func (u *USLModel) NumParams() int { return 4 }
+
+func (u *USLModel) Coefficients() []Coefficient {
+	return []Coefficient{{"lambda", u.Lambda}, {"sigma", u.Sigma}, {"kappa", u.Kappa}, {"latency scale", u.LatencyScale}}
+}
+
+// Fit fits the model to throughput vs. load, so it only applies to fixed
+// concurrency tests.
+func (u *USLModel) Fit(observations []Observation) error {
+	n := len(observations)
+	if n < 3 {
+		return fmt.Errorf("insufficient data points for USL fit (need at least 3)")
+	}
+
+	concurrency := make([]float64, n)
+	throughput := make([]float64, n)
+	weights := make([]float64, n)
+	lambda0, maxConcurrency, scale := 0.0, 0.0, 0.0
+	for i, o := range observations {
+		if o.Load < 1 || o.Throughput <= 0 || o.AvgLatency <= 0 {
+			return fmt.Errorf("no throughput or latency measured at concurrency %g", o.Load)
+		}
+		concurrency[i] = o.Load
+		throughput[i] = o.Throughput
+		weights[i] = weightOf(o.Weight)
+		lambda0 = math.Max(lambda0, o.Throughput/o.Load)
+		maxConcurrency = math.Max(maxConcurrency, o.Load)
+		scale += o.Latency / o.AvgLatency
+	}
+
+	// Linearize for a starting point: with C(N) = X(N)/λN,
+	// 1/C(N) - 1 = σ(N-1) + κN(N-1) = (σ+κ)x + κx² for x = N-1
+	var sxx, sxxx, sxxxx, sxy, sxxy float64
+	for i := range concurrency {
+		x := concurrency[i] - 1
+		y := lambda0*concurrency[i]/throughput[i] - 1
+		sxx += x * x
+		sxxx += x * x * x
+		sxxxx += x * x * x * x
+		sxy += x * y
+		sxxy += x * x * y
+	}
+	sigma0, kappa0 := 0.01, 0.0001
+	if det := sxx*sxxxx - sxxx*sxxx; det != 0 {
+		a := (sxx*sxxy - sxxx*sxy) / det // κ
+		b := (sxxxx*sxy - sxxx*sxxy) / det
+		kappa0 = math.Max(a, 1e-9)
+		sigma0 = math.Max(b-a, 1e-6)
+	}
+
+	// Refine by minimizing the weighted relative throughput error. Parameters
+	// are scaled to be of similar magnitude: [λ/λ0, σ, κN²max].
+	model := func(p []float64, n float64) float64 {
+		lambda := math.Abs(p[0]) * lambda0
+		sigma := math.Abs(p[1])
+		kappa := math.Abs(p[2]) / (maxConcurrency * maxConcurrency)
+		return lambda * n / (1 + sigma*(n-1) + kappa*n*(n-1))
+	}
+	problem := optimize.Problem{
+		Func: func(p []float64) float64 {
+			sse := 0.0
+			for i := range concurrency {
+				residual := (throughput[i] - model(p, concurrency[i])) / throughput[i]
+				sse += weights[i] * residual * residual
+			}
+			return sse
+		},
+	}
+	initial := []float64{1, sigma0, kappa0 * maxConcurrency * maxConcurrency}
+	result, err := optimize.Minimize(problem, initial, nil, &optimize.NelderMead{})
+	if err != nil {
+		return fmt.Errorf("failed to fit USL: %w", err)
+	}
+
+	u.Lambda = math.Abs(result.X[0]) * lambda0
+	u.Sigma = math.Abs(result.X[1])
+	u.Kappa = math.Abs(result.X[2]) / (maxConcurrency * maxConcurrency)
+	u.LatencyScale = scale / float64(n)
+	return nil
+}
+
+// Throughput returns the modeled RPS at concurrency n
+func (u *USLModel) Throughput(n float64) float64 {
+	return u.Lambda * n / (1 + u.Sigma*(n-1) + u.Kappa*n*(n-1))
+}
+
+// Predict returns the modeled latency (ms) at concurrency n
+func (u *USLModel) Predict(n float64) float64 {
+	return u.LatencyScale * 1000 * (1 + u.Sigma*(n-1) + u.Kappa*n*(n-1)) / u.Lambda
+}
+
+// PeakConcurrency returns the concurrency with the highest throughput, which
+// is unbounded without a coherency penalty.
+func (u *USLModel) PeakConcurrency() float64 {
+	if u.Kappa <= 0 {
+		return math.Inf(1)
+	}
+	return math.Sqrt((1 - u.Sigma) / u.Kappa)
+}
+
+// MaxThroughput returns the throughput at PeakConcurrency, or λ/σ as the
+// asymptote when there is no coherency penalty.
+func (u *USLModel) MaxThroughput() float64 {
+	peak := u.PeakConcurrency()
+	if math.IsInf(peak, 1) {
+		if u.Sigma <= 0 {
+			return math.Inf(1)
+		}
+		return u.Lambda / u.Sigma
+	}
+	return u.Throughput(peak)
+}
+
+// Solve returns the concurrency at which the modeled latency reaches
+// targetLatency (ms):
+//
+//	κN² + (σ-κ)N + (1-σ) - λT = 0, with T the target mean latency in seconds
+func (u *USLModel) Solve(targetLatency float64) (float64, error) {
+	t := targetLatency / 1000 / u.LatencyScale
+	a := u.Kappa
+	b := u.Sigma - u.Kappa
+	c := 1 - u.Sigma - u.Lambda*t
+
+	if a < 1e-15 {
+		if b <= 0 {
+			return 0, fmt.Errorf("USL fit has no contention, latency never reaches %.2fms", targetLatency)
+		}
+		return -c / b, nil
+	}
+	delta := b*b - 4*a*c
+	if delta < 0 {
+		return 0, fmt.Errorf("no real solutions for concurrency at target latency %.2fms", targetLatency)
+	}
+	return (-b + math.Sqrt(delta)) / (2 * a), nil
+}
+
+func (u *USLModel) Describe() string {
+	return fmt.Sprintf("USL fit: Throughput (RPS) = %.2fN / (1 + %.4f(N-1) + %.6fN(N-1))\nUSL peak concurrency: %.2f, max throughput: %.2f RPS", u.Lambda, u.Sigma, u.Kappa, u.PeakConcurrency(), u.MaxThroughput())
+}